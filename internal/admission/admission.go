@@ -0,0 +1,461 @@
+// Package admission limits how many requests run at once per model and per
+// backend. Requests over the limits wait in a bounded queue that is served
+// round-robin across API keys, so one busy client cannot starve the others.
+//
+// Requests are interactive or batch. Waiting interactive requests go first,
+// except that batch keeps a minimum share of admissions, and a waiting
+// interactive request may preempt a running batch one.
+package admission
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull means the queue (or the key's share of it) is full
+	ErrQueueFull = errors.New("request queue is full")
+	// ErrQueueTimeout means the request waited longer than Config.QueueTimeout
+	ErrQueueTimeout = errors.New("timed out waiting in the request queue")
+	// ErrPreempted is the cause of a batch request cancelled to make room
+	// for interactive traffic
+	ErrPreempted = errors.New("preempted by higher-priority traffic")
+)
+
+type Class int
+
+const (
+	Interactive Class = iota
+	Batch
+)
+
+// ParseClass accepts "interactive" and "batch"
+func ParseClass(s string) (Class, bool) {
+	switch s {
+	case "interactive":
+		return Interactive, true
+	case "batch":
+		return Batch, true
+	}
+	return Interactive, false
+}
+
+func (c Class) String() string {
+	if c == Batch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+type Config struct {
+	// ModelLimit caps running requests per model; 0 means no cap
+	ModelLimit int
+	// ModelLimits overrides ModelLimit by model name or glob
+	ModelLimits map[string]int
+	// BackendLimits caps running requests per backend name
+	BackendLimits map[string]int
+	// MaxQueue bounds waiting requests in total, MaxQueuePerKey per key
+	// (0 = only the total bound)
+	MaxQueue       int
+	MaxQueuePerKey int
+	QueueTimeout   time.Duration
+	// BatchShare is the fraction of admissions batch requests get while
+	// interactive ones are also waiting (0 to 1)
+	BatchShare float64
+	// Preempt cancels running batch requests that keep a waiting
+	// interactive request from starting
+	Preempt bool
+}
+
+// Request describes what a request needs a slot for
+type Request struct {
+	// Key identifies the client for fair queueing
+	Key     string
+	Backend string
+	Model   string
+	Class   Class
+}
+
+// Stats are cumulative counters plus the current load
+type Stats struct {
+	Running      int            `json:"running"`
+	RunningBatch int            `json:"running_batch"`
+	Queued       int            `json:"queued"`
+	QueuedBatch  int            `json:"queued_batch"`
+	Keys         int            `json:"queued_keys"`
+	Models       map[string]int `json:"running_by_model,omitempty"`
+	Backends     map[string]int `json:"running_by_backend,omitempty"`
+	Waiting      map[string]int `json:"queued_by_model,omitempty"`
+	Admitted     uint64         `json:"admitted"`
+	Delayed      uint64         `json:"delayed"`
+	Rejected     uint64         `json:"rejected"`
+	TimedOut     uint64         `json:"timed_out"`
+	Preempted    uint64         `json:"preempted"`
+	MaxWaitMS    int64          `json:"max_wait_ms"`
+	AvgWaitMS    int64          `json:"avg_wait_ms"`
+}
+
+type waiter struct {
+	Request
+	queued  time.Time
+	ready   chan struct{}
+	granted bool
+
+	// cancel ends the request's context; started and preempted track
+	// running batch requests
+	cancel    context.CancelCauseFunc
+	started   time.Time
+	preempted bool
+}
+
+// ring is a set of per-key FIFO queues taken in turn
+type ring struct {
+	queues map[string][]*waiter
+	order  []string
+	next   int
+	size   int
+}
+
+type Controller struct {
+	cfg Config
+
+	mu       sync.Mutex
+	models   map[string]int
+	backends map[string]int
+	// waiting requests, one ring per class
+	rings [2]*ring
+	// running batch requests, the candidates for preemption
+	batch map[*waiter]bool
+	// admissions owed to batch; see Config.BatchShare
+	batchCredit float64
+
+	stats     Stats
+	totalWait time.Duration
+}
+
+func New(cfg Config) *Controller {
+	return &Controller{
+		cfg:      cfg,
+		models:   map[string]int{},
+		backends: map[string]int{},
+		rings:    [2]*ring{newRing(), newRing()},
+		batch:    map[*waiter]bool{},
+	}
+}
+
+func newRing() *ring {
+	return &ring{queues: map[string][]*waiter{}}
+}
+
+// Acquire waits until req may run. It returns the context to run it under,
+// which is cancelled with ErrPreempted if the request is preempted, and the
+// function that frees its slot.
+func (c *Controller) Acquire(ctx context.Context, req Request) (context.Context, func(), error) {
+	w := &waiter{Request: req, queued: time.Now(), ready: make(chan struct{})}
+	ctx, w.cancel = context.WithCancelCause(ctx)
+
+	c.mu.Lock()
+	// nothing admissible is ever left waiting, so a request that fits now
+	// can skip the queue without overtaking anyone for the same slot
+	if c.fits(w) {
+		c.start(w)
+		c.mu.Unlock()
+		return ctx, c.releaser(w), nil
+	}
+	if (c.cfg.MaxQueue > 0 && c.queued() >= c.cfg.MaxQueue) ||
+		(c.cfg.MaxQueuePerKey > 0 && c.queuedFor(req.Key) >= c.cfg.MaxQueuePerKey) {
+		c.stats.Rejected++
+		c.mu.Unlock()
+		w.cancel(nil)
+		return nil, nil, ErrQueueFull
+	}
+	c.rings[req.Class].enqueue(w)
+	c.stats.Delayed++
+	if req.Class == Interactive && c.cfg.Preempt {
+		c.preemptFor(w)
+	}
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if c.cfg.QueueTimeout > 0 {
+		t := time.NewTimer(c.cfg.QueueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	var err error
+	select {
+	case <-w.ready:
+		return ctx, c.releaser(w), nil
+	case <-ctx.Done():
+		err = context.Cause(ctx)
+	case <-timeout:
+		err = ErrQueueTimeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if w.granted {
+		// granted while giving up: hand the slot on
+		c.finish(w)
+	} else {
+		c.rings[req.Class].remove(w)
+	}
+	if err == ErrQueueTimeout {
+		c.stats.TimedOut++
+	}
+	w.cancel(nil)
+	return nil, nil, err
+}
+
+func (c *Controller) releaser(w *waiter) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			c.finish(w)
+			c.mu.Unlock()
+			w.cancel(nil)
+		})
+	}
+}
+
+// Stats returns a snapshot of the counters and current load
+func (c *Controller) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.RunningBatch = len(c.batch)
+	s.Queued, s.QueuedBatch = c.queued(), c.rings[Batch].size
+	s.Models, s.Backends, s.Waiting = map[string]int{}, map[string]int{}, map[string]int{}
+	for m, n := range c.models {
+		s.Models[m] = n
+	}
+	for b, n := range c.backends {
+		s.Backends[b] = n
+	}
+	keys := map[string]bool{}
+	for _, r := range c.rings {
+		for key, q := range r.queues {
+			keys[key] = true
+			for _, w := range q {
+				s.Waiting[w.Backend+"/"+w.Model]++
+			}
+		}
+	}
+	s.Keys = len(keys)
+	if s.Admitted > 0 {
+		s.AvgWaitMS = c.totalWait.Milliseconds() / int64(s.Admitted)
+	}
+	return s
+}
+
+func (c *Controller) queued() int {
+	return c.rings[Interactive].size + c.rings[Batch].size
+}
+
+func (c *Controller) queuedFor(key string) int {
+	return len(c.rings[Interactive].queues[key]) + len(c.rings[Batch].queues[key])
+}
+
+func (c *Controller) modelLimit(model string) int {
+	if n, ok := c.cfg.ModelLimits[model]; ok {
+		return n
+	}
+	best := ""
+	for pattern := range c.cfg.ModelLimits {
+		if ok, _ := path.Match(pattern, model); ok && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	if best != "" {
+		return c.cfg.ModelLimits[best]
+	}
+	return c.cfg.ModelLimit
+}
+
+func (c *Controller) fits(w *waiter) bool {
+	return !c.modelFull(w) && !c.backendFull(w)
+}
+
+func (c *Controller) modelFull(w *waiter) bool {
+	n := c.modelLimit(w.Model)
+	return n > 0 && c.models[w.Backend+"/"+w.Model] >= n
+}
+
+func (c *Controller) backendFull(w *waiter) bool {
+	n := c.cfg.BackendLimits[w.Backend]
+	return n > 0 && c.backends[w.Backend] >= n
+}
+
+func (c *Controller) start(w *waiter) {
+	c.models[w.Backend+"/"+w.Model]++
+	c.backends[w.Backend]++
+	if w.Class == Batch {
+		w.started = time.Now()
+		c.batch[w] = true
+	}
+	c.stats.Running++
+	c.stats.Admitted++
+	wait := time.Since(w.queued)
+	c.totalWait += wait
+	if ms := wait.Milliseconds(); ms > c.stats.MaxWaitMS {
+		c.stats.MaxWaitMS = ms
+	}
+}
+
+// finish frees w's slot and admits whoever can use it
+func (c *Controller) finish(w *waiter) {
+	m := w.Backend + "/" + w.Model
+	if c.models[m]--; c.models[m] <= 0 {
+		delete(c.models, m)
+	}
+	if c.backends[w.Backend]--; c.backends[w.Backend] <= 0 {
+		delete(c.backends, w.Backend)
+	}
+	delete(c.batch, w)
+	c.stats.Running--
+	c.dispatch()
+}
+
+// dispatch admits waiting requests until nothing more fits. Interactive
+// requests go first unless batch is owed its share.
+func (c *Controller) dispatch() {
+	for c.queued() > 0 {
+		var w *waiter
+		if c.batchCredit >= 1 {
+			if w = c.rings[Batch].pick(c.fits); w != nil {
+				c.batchCredit--
+			}
+		}
+		if w == nil {
+			if w = c.rings[Interactive].pick(c.fits); w != nil && c.rings[Batch].size > 0 {
+				c.owe()
+			}
+		}
+		if w == nil {
+			w = c.rings[Batch].pick(c.fits)
+		}
+		if w == nil {
+			return
+		}
+		c.start(w)
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// owe credits batch for an interactive admission made while batch waited:
+// a share s means one batch admission per (1-s)/s interactive ones
+func (c *Controller) owe() {
+	s := c.cfg.BatchShare
+	switch {
+	case s <= 0:
+		return
+	case s >= 1:
+		c.batchCredit = 1
+	default:
+		c.batchCredit = min(c.batchCredit+s/(1-s), 1)
+	}
+}
+
+// preemptFor cancels the most recently started batch request holding a
+// slot w needs, unless enough are already on their way out for the
+// interactive requests waiting for that slot
+func (c *Controller) preemptFor(w *waiter) {
+	modelFull := c.modelFull(w)
+	blocks := func(x *waiter) bool {
+		if modelFull {
+			return x.Backend == w.Backend && x.Model == w.Model
+		}
+		return x.Backend == w.Backend
+	}
+	var victim *waiter
+	leaving := 0
+	for b := range c.batch {
+		switch {
+		case !blocks(b):
+		case b.preempted:
+			leaving++
+		case victim == nil || b.started.After(victim.started):
+			victim = b
+		}
+	}
+	waiting := 0
+	for _, q := range c.rings[Interactive].queues {
+		for _, x := range q {
+			if blocks(x) {
+				waiting++
+			}
+		}
+	}
+	if victim != nil && leaving < waiting {
+		victim.preempted = true
+		c.stats.Preempted++
+		victim.cancel(ErrPreempted)
+	}
+}
+
+func (r *ring) enqueue(w *waiter) {
+	if len(r.queues[w.Key]) == 0 {
+		r.order = append(r.order, w.Key)
+	}
+	r.queues[w.Key] = append(r.queues[w.Key], w)
+	r.size++
+}
+
+// pick removes and returns the oldest request that fits from the next key
+// in turn that has one
+func (r *ring) pick(fits func(*waiter) bool) *waiter {
+	for i := 0; i < len(r.order); i++ {
+		k := (r.next + i) % len(r.order)
+		key := r.order[k]
+		for _, w := range r.queues[key] {
+			if !fits(w) {
+				continue
+			}
+			r.remove(w)
+			// the next turn goes to the key after this one; remove may
+			// have dropped this key from the ring
+			if k < len(r.order) && r.order[k] == key {
+				k++
+			}
+			r.next = 0
+			if len(r.order) > 0 {
+				r.next = k % len(r.order)
+			}
+			return w
+		}
+	}
+	return nil
+}
+
+func (r *ring) remove(w *waiter) {
+	q := r.queues[w.Key]
+	for i, x := range q {
+		if x == w {
+			q = append(q[:i:i], q[i+1:]...)
+			r.size--
+			break
+		}
+	}
+	if len(q) > 0 {
+		r.queues[w.Key] = q
+		return
+	}
+	delete(r.queues, w.Key)
+	for i, k := range r.order {
+		if k == w.Key {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			if r.next > i {
+				r.next--
+			}
+			break
+		}
+	}
+	if r.next >= len(r.order) {
+		r.next = 0
+	}
+}
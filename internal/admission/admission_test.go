@@ -0,0 +1,220 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type grant struct {
+	req     Request
+	ctx     context.Context
+	release func()
+	err     error
+}
+
+// enqueue starts Acquire for req and waits until it is queued
+func enqueue(t *testing.T, c *Controller, req Request, granted chan<- grant) {
+	t.Helper()
+	before := c.Stats().Queued
+	go func() {
+		ctx, release, err := c.Acquire(context.Background(), req)
+		granted <- grant{req, ctx, release, err}
+	}()
+	deadline := time.Now().Add(time.Second)
+	for c.Stats().Queued == before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%+v was not queued", req)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func acquire(t *testing.T, c *Controller, req Request) (context.Context, func()) {
+	t.Helper()
+	ctx, release, err := c.Acquire(context.Background(), req)
+	if err != nil {
+		t.Fatalf("acquire %+v: %v", req, err)
+	}
+	return ctx, release
+}
+
+func next(t *testing.T, granted <-chan grant) grant {
+	t.Helper()
+	select {
+	case g := <-granted:
+		if g.err != nil {
+			t.Fatalf("acquire %+v: %v", g.req, g.err)
+		}
+		return g
+	case <-time.After(time.Second):
+		t.Fatal("nothing was admitted")
+	}
+	return grant{}
+}
+
+func TestPreemption(t *testing.T) {
+	c := New(Config{ModelLimit: 1, Preempt: true})
+	batchCtx, releaseBatch := acquire(t, c, Request{Key: "b", Model: "m", Class: Batch})
+
+	granted := make(chan grant, 1)
+	enqueue(t, c, Request{Key: "i", Model: "m", Class: Interactive}, granted)
+
+	select {
+	case <-batchCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("batch request was not preempted")
+	}
+	if cause := context.Cause(batchCtx); !errors.Is(cause, ErrPreempted) {
+		t.Fatalf("cause %v, want ErrPreempted", cause)
+	}
+	// the slot is only handed over once the batch request lets go of it
+	select {
+	case <-granted:
+		t.Fatal("admitted before the preempted request released its slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+	releaseBatch()
+	g := next(t, granted)
+	g.release()
+	if n := c.Stats().Preempted; n != 1 {
+		t.Errorf("Preempted = %d, want 1", n)
+	}
+}
+
+func TestPreemptionOff(t *testing.T) {
+	c := New(Config{ModelLimit: 1})
+	batchCtx, releaseBatch := acquire(t, c, Request{Key: "b", Model: "m", Class: Batch})
+	granted := make(chan grant, 1)
+	enqueue(t, c, Request{Key: "i", Model: "m", Class: Interactive}, granted)
+
+	time.Sleep(20 * time.Millisecond)
+	if batchCtx.Err() != nil {
+		t.Fatal("batch request was preempted with Preempt off")
+	}
+	releaseBatch()
+	next(t, granted).release()
+}
+
+func TestPreemptionOtherModel(t *testing.T) {
+	c := New(Config{ModelLimit: 1, Preempt: true})
+	batchCtx, releaseBatch := acquire(t, c, Request{Key: "b", Model: "other", Class: Batch})
+	defer releaseBatch()
+	_, release := acquire(t, c, Request{Key: "i", Model: "m", Class: Interactive})
+	defer release()
+	granted := make(chan grant, 1)
+	enqueue(t, c, Request{Key: "i", Model: "m", Class: Interactive}, granted)
+
+	time.Sleep(20 * time.Millisecond)
+	if batchCtx.Err() != nil {
+		t.Fatal("preempted a batch request that does not hold the needed slot")
+	}
+}
+
+// admissionOrder queues reqs behind a held slot of a limit-1 model and
+// returns the classes in the order they are admitted
+func admissionOrder(t *testing.T, cfg Config, reqs []Request) []Class {
+	t.Helper()
+	c := New(cfg)
+	_, release := acquire(t, c, Request{Key: "holder", Model: "m"})
+	granted := make(chan grant, len(reqs))
+	for _, r := range reqs {
+		enqueue(t, c, r, granted)
+	}
+	var order []Class
+	for range reqs {
+		release()
+		g := next(t, granted)
+		order = append(order, g.req.Class)
+		release = g.release
+	}
+	release()
+	return order
+}
+
+func TestBatchShare(t *testing.T) {
+	var reqs []Request
+	for range 4 {
+		reqs = append(reqs, Request{Key: "b", Model: "m", Class: Batch})
+	}
+	for range 4 {
+		reqs = append(reqs, Request{Key: "i", Model: "m", Class: Interactive})
+	}
+	I, B := Interactive, Batch
+
+	tests := []struct {
+		share float64
+		want  []Class
+	}{
+		{0, []Class{I, I, I, I, B, B, B, B}},
+		{0.5, []Class{I, B, I, B, I, B, I, B}},
+		{0.25, []Class{I, I, I, B, I, B, B, B}},
+		{1, []Class{I, B, I, B, I, B, I, B}},
+	}
+	for _, tt := range tests {
+		got := admissionOrder(t, Config{ModelLimit: 1, BatchShare: tt.share}, reqs)
+		if !equalClasses(got, tt.want) {
+			t.Errorf("share %v: order %v, want %v", tt.share, got, tt.want)
+		}
+	}
+}
+
+func equalClasses(a, b []Class) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRoundRobin(t *testing.T) {
+	c := New(Config{ModelLimit: 1})
+	_, release := acquire(t, c, Request{Key: "holder", Model: "m"})
+	granted := make(chan grant, 6)
+	for _, key := range []string{"a", "a", "a", "b", "c", "c"} {
+		enqueue(t, c, Request{Key: key, Model: "m"}, granted)
+	}
+	var keys []string
+	for range 6 {
+		release()
+		g := next(t, granted)
+		keys = append(keys, g.req.Key)
+		release = g.release
+	}
+	release()
+	want := []string{"a", "b", "c", "a", "c", "a"}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("order %v, want %v", keys, want)
+		}
+	}
+}
+
+func TestQueueLimits(t *testing.T) {
+	c := New(Config{ModelLimit: 1, MaxQueue: 2, MaxQueuePerKey: 1, QueueTimeout: 50 * time.Millisecond})
+	_, release := acquire(t, c, Request{Key: "holder", Model: "m"})
+	defer release()
+
+	granted := make(chan grant, 2)
+	enqueue(t, c, Request{Key: "a", Model: "m"}, granted)
+	if _, _, err := c.Acquire(context.Background(), Request{Key: "a", Model: "m"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("second request for key a: %v, want ErrQueueFull", err)
+	}
+	enqueue(t, c, Request{Key: "b", Model: "m"}, granted)
+	if _, _, err := c.Acquire(context.Background(), Request{Key: "c", Model: "m"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("third queued request: %v, want ErrQueueFull", err)
+	}
+	for range 2 {
+		if g := <-granted; !errors.Is(g.err, ErrQueueTimeout) {
+			t.Errorf("key %s: %v, want ErrQueueTimeout", g.req.Key, g.err)
+		}
+	}
+	if s := c.Stats(); s.Rejected != 2 || s.TimedOut != 2 || s.Queued != 0 {
+		t.Errorf("stats %+v", s)
+	}
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/calvarado2004/LlamaMux/internal/ollama"
+)
+
+// Admin endpoints manage models on Ollama backends. They require
+// LLAMAMUX_ADMIN_KEY as a bearer token and are disabled without it. Models
+// are routed like any other, so "gpu2/llama3:8b" acts on the Ollama backend
+// named gpu2.
+
+type adminModelRequest struct {
+	Model     string      `json:"model"`
+	Stream    *bool       `json:"stream,omitempty"`
+	KeepAlive interface{} `json:"keep_alive,omitempty"`
+}
+
+// admin wraps h with the admin key check and a method check
+func (s *Server) admin(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.AdminKey == "" {
+			writeError(w, http.StatusForbidden, "admin endpoints are disabled; set LLAMAMUX_ADMIN_KEY")
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminKey)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid admin key")
+			return
+		}
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// adminTarget decodes an admin request and resolves the Ollama backend for
+// its model; req.Model is replaced by the upstream name
+func (s *Server) adminTarget(w http.ResponseWriter, r *http.Request) (*ollama.Client, adminModelRequest, bool) {
+	var req adminModelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return nil, req, false
+	}
+	if req.Model == "" {
+		writeError(w, http.StatusBadRequest, "model is required")
+		return nil, req, false
+	}
+	name, backend, upstream := s.llm.Route(req.Model)
+	client, ok := backend.(*ollama.Client)
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("backend %s is not Ollama; model management needs an Ollama backend", name))
+		return nil, req, false
+	}
+	req.Model = upstream
+	return client, req, true
+}
+
+// handlePull downloads a model. Progress is streamed as NDJSON, like
+// Ollama's own /api/pull, unless "stream": false.
+func (s *Server) handlePull(w http.ResponseWriter, r *http.Request) {
+	client, req, ok := s.adminTarget(w, r)
+	if !ok {
+		return
+	}
+	if req.Stream != nil && !*req.Stream {
+		if err := client.Pull(r.Context(), req.Model, nil); err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "success", "model": req.Model})
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	started := false
+	err := client.Pull(r.Context(), req.Model, func(p ollama.PullProgress) {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			started = true
+		}
+		enc.Encode(p)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+	if err != nil {
+		if !started {
+			writeUpstreamError(w, err)
+			return
+		}
+		enc.Encode(map[string]interface{}{"error": upstreamError(err)})
+	}
+}
+
+func (s *Server) handleDeleteModel(w http.ResponseWriter, r *http.Request) {
+	client, req, ok := s.adminTarget(w, r)
+	if !ok {
+		return
+	}
+	if err := client.Delete(r.Context(), req.Model); err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted", "model": req.Model})
+}
+
+func (s *Server) handleShowModel(w http.ResponseWriter, r *http.Request) {
+	client, req, ok := s.adminTarget(w, r)
+	if !ok {
+		return
+	}
+	show, err := client.Show(r.Context(), req.Model)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, show)
+}
+
+// handlePS lists the loaded models of every Ollama backend
+func (s *Server) handlePS(w http.ResponseWriter, r *http.Request) {
+	models := []interface{}{}
+	errs := map[string]string{}
+	for _, name := range s.llm.Names() {
+		client, ok := s.llm.Backend(name).(*ollama.Client)
+		if !ok {
+			continue
+		}
+		ps, err := client.PS(r.Context())
+		if err != nil {
+			errs[name] = err.Error()
+			continue
+		}
+		list, _ := ps["models"].([]interface{})
+		for _, m := range list {
+			if entry, ok := m.(map[string]interface{}); ok {
+				entry["backend"] = name
+				models = append(models, entry)
+			}
+		}
+	}
+	out := map[string]interface{}{"models": models}
+	if len(errs) > 0 {
+		out["errors"] = errs
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleLoadModel preloads a model; keep_alive sets how long it stays
+// loaded (Ollama's default when omitted)
+func (s *Server) handleLoadModel(w http.ResponseWriter, r *http.Request) {
+	client, req, ok := s.adminTarget(w, r)
+	if !ok {
+		return
+	}
+	if err := client.Load(r.Context(), req.Model, req.KeepAlive); err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "loaded", "model": req.Model, "keep_alive": req.KeepAlive})
+}
+
+func (s *Server) handleUnloadModel(w http.ResponseWriter, r *http.Request) {
+	client, req, ok := s.adminTarget(w, r)
+	if !ok {
+		return
+	}
+	if err := client.Unload(r.Context(), req.Model); err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "unloaded", "model": req.Model})
+}
@@ -0,0 +1,530 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/calvarado2004/LlamaMux/internal/llm"
+)
+
+// Anthropic Messages API front-end. Requests are translated into the same
+// ChatMessage shape used by /v1/chat/completions so OCR, document and audio
+// enrichment apply unchanged.
+
+func writeAnthropicError(w http.ResponseWriter, status int, errType, msg string) {
+	writeJSON(w, status, map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    errType,
+			"message": msg,
+		},
+	})
+}
+
+// anthropicErrorType maps a status onto the Anthropic error types
+func anthropicErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		return "overloaded_error"
+	}
+	return "api_error"
+}
+
+func writeAnthropicUpstreamError(ctx context.Context, w http.ResponseWriter, err error) {
+	e := requestError(ctx, err)
+	writeAnthropicError(w, e.status, anthropicErrorType(e.status), e.Message)
+}
+
+// anthropicText joins text blocks, or returns a plain string as-is
+func anthropicText(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []interface{}:
+		var parts []string
+		for _, b := range t {
+			if m, ok := b.(map[string]interface{}); ok && m["type"] == "text" {
+				if txt, ok := m["text"].(string); ok {
+					parts = append(parts, txt)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// anthropicSource turns an image/document "source" into a URL, data URL included
+func anthropicSource(block map[string]interface{}) string {
+	src, _ := block["source"].(map[string]interface{})
+	switch src["type"] {
+	case "base64":
+		mt, _ := src["media_type"].(string)
+		data, _ := src["data"].(string)
+		return "data:" + mt + ";base64," + data
+	case "url":
+		u, _ := src["url"].(string)
+		return u
+	}
+	return ""
+}
+
+// anthropicParts converts content blocks into chat parts plus any tool calls
+func anthropicParts(blocks []interface{}) (parts []interface{}, calls []ToolCall, results []ChatMessage) {
+	for _, b := range blocks {
+		block, ok := b.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch block["type"] {
+		case "text":
+			parts = append(parts, map[string]interface{}{"type": "text", "text": block["text"]})
+
+		case "image":
+			if u := anthropicSource(block); u != "" {
+				parts = append(parts, map[string]interface{}{
+					"type":      "image_url",
+					"image_url": map[string]interface{}{"url": u},
+				})
+			}
+
+		case "document":
+			src, _ := block["source"].(map[string]interface{})
+			if src["type"] == "text" {
+				parts = append(parts, map[string]interface{}{"type": "text", "text": src["data"]})
+			} else if u := anthropicSource(block); u != "" {
+				title, _ := block["title"].(string)
+				parts = append(parts, map[string]interface{}{
+					"type": "file",
+					"file": map[string]interface{}{"file_data": u, "filename": title},
+				})
+			}
+
+		case "tool_use":
+			id, _ := block["id"].(string)
+			name, _ := block["name"].(string)
+			args, _ := json.Marshal(block["input"])
+			calls = append(calls, ToolCall{
+				ID:       id,
+				Type:     "function",
+				Function: ToolCallFunction{Name: name, Arguments: string(args)},
+			})
+
+		case "tool_result":
+			id, _ := block["tool_use_id"].(string)
+			var content interface{} = block["content"]
+			if inner, ok := content.([]interface{}); ok {
+				innerParts, _, _ := anthropicParts(inner)
+				content = innerParts
+			}
+			if isErr, _ := block["is_error"].(bool); isErr {
+				if txt, ok := content.(string); ok {
+					content = "[tool error] " + txt
+				}
+			}
+			results = append(results, ChatMessage{Role: "tool", Content: content, ToolCallID: id})
+		}
+	}
+	return parts, calls, results
+}
+
+func anthropicToChat(req AnthropicMessagesRequest) []ChatMessage {
+	var msgs []ChatMessage
+	if sys := anthropicText(req.System); sys != "" {
+		msgs = append(msgs, ChatMessage{Role: "system", Content: sys})
+	}
+
+	for _, m := range req.Messages {
+		blocks, ok := m.Content.([]interface{})
+		if !ok {
+			msgs = append(msgs, ChatMessage{Role: m.Role, Content: m.Content})
+			continue
+		}
+		parts, calls, results := anthropicParts(blocks)
+		// tool results answer the previous assistant turn, so they come first
+		msgs = append(msgs, results...)
+		if len(parts) > 0 || len(calls) > 0 {
+			var content interface{}
+			if len(parts) > 0 {
+				content = parts
+			}
+			msgs = append(msgs, ChatMessage{Role: m.Role, Content: content, ToolCalls: calls})
+		}
+	}
+	return msgs
+}
+
+// anthropicStopReason maps a finish to stop_reason; stopSeq is the matched
+// stop sequence, if any
+func anthropicStopReason(doneReason string, toolUse bool, stopSeq string) string {
+	switch {
+	case toolUse:
+		return "tool_use"
+	case stopSeq != "":
+		return "stop_sequence"
+	case doneReason == "length":
+		return "max_tokens"
+	}
+	return "end_turn"
+}
+
+// stopSequence is the stop_sequence field: the matched string or null
+func stopSequence(seq string) interface{} {
+	if seq == "" {
+		return nil
+	}
+	return seq
+}
+
+// stopScanner finds stop_sequences in generated text. Backends strip the
+// sequence they stop on without saying which one it was, so the gateway
+// matches them itself: text that could be the start of a sequence is held
+// back until the next chunk decides it.
+type stopScanner struct {
+	seqs    []string
+	hold    string
+	matched string
+}
+
+// feed returns the text that can be emitted. Once a sequence matches, that
+// is the text before it, and matched is set.
+func (sc *stopScanner) feed(text string) string {
+	if sc.matched != "" {
+		return ""
+	}
+	buf := sc.hold + text
+	first := -1
+	for _, seq := range sc.seqs {
+		if i := strings.Index(buf, seq); seq != "" && i >= 0 && (first < 0 || i < first) {
+			first, sc.matched = i, seq
+		}
+	}
+	if first >= 0 {
+		sc.hold = ""
+		return buf[:first]
+	}
+	keep := 0
+	for _, seq := range sc.seqs {
+		for k := min(len(seq)-1, len(buf)); k > keep; k-- {
+			if strings.HasSuffix(buf, seq[:k]) {
+				keep = k
+				break
+			}
+		}
+	}
+	sc.hold = buf[len(buf)-keep:]
+	return buf[:len(buf)-keep]
+}
+
+// flush returns the text held back, which no sequence matched
+func (sc *stopScanner) flush() string {
+	h := sc.hold
+	sc.hold = ""
+	return h
+}
+
+func toolUseBlock(i int, tc llm.ToolCall) map[string]interface{} {
+	input := tc.Function.Arguments
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+	id := tc.ID
+	if id == "" {
+		id = fmt.Sprintf("toolu_%d_%d", time.Now().UnixMilli(), i)
+	}
+	return map[string]interface{}{
+		"type":  "tool_use",
+		"id":    id,
+		"name":  tc.Function.Name,
+		"input": input,
+	}
+}
+
+func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
+	var req AnthropicMessagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON")
+		return
+	}
+	if req.Model == "" {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "model is required for /v1/messages")
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "messages must not be empty")
+		return
+	}
+
+	// stop_sequences are matched here, not upstream (see stopScanner)
+	params := llm.Params{
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		TopK:        req.TopK,
+	}
+	for _, t := range req.Tools {
+		params.Tools = append(params.Tools, llm.Tool{
+			Type: "function",
+			Function: llm.ToolFunction{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.InputSchema,
+			},
+		})
+	}
+
+	enriched := s.toBackendMessages(r.Context(), anthropicToChat(req))
+	backend, upstream := s.backendFor(req.Model)
+	admitted, release, aerr := s.admit(w, r, req.Model)
+	if aerr != nil {
+		writeAnthropicError(w, aerr.status, anthropicErrorType(aerr.status), aerr.Message)
+		return
+	}
+	defer release()
+	r = r.WithContext(admitted)
+	msgID := fmt.Sprintf("msg_%d", time.Now().UnixMilli())
+
+	enriched, info, err := s.fitContext(r, backend, upstream, enriched, &params)
+	if err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	info.writeHeaders(w)
+
+	if req.Stream {
+		s.streamMessages(r.Context(), w, msgID, req.Model, backend, upstream, enriched, params, req.StopSequences, info.promptTokens)
+		return
+	}
+
+	var ans *llm.ChatResponse
+	var matched string
+	if len(req.StopSequences) > 0 {
+		ans, matched, err = s.callUntilStop(r.Context(), backend, enriched, upstream, params, req.StopSequences, info.promptTokens)
+	} else {
+		ans, err = backend.CallChat(r.Context(), enriched, upstream, params)
+	}
+	if err != nil {
+		writeAnthropicUpstreamError(r.Context(), w, err)
+		return
+	}
+
+	content := []interface{}{}
+	if ans.Content != "" {
+		content = append(content, map[string]interface{}{"type": "text", "text": ans.Content})
+	}
+	for i, tc := range ans.ToolCalls {
+		content = append(content, toolUseBlock(i, tc))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":            msgID,
+		"type":          "message",
+		"role":          "assistant",
+		"model":         req.Model,
+		"content":       content,
+		"stop_reason":   anthropicStopReason(ans.DoneReason, len(ans.ToolCalls) > 0, matched),
+		"stop_sequence": stopSequence(matched),
+		"usage": map[string]interface{}{
+			"input_tokens":  ans.PromptTokens,
+			"output_tokens": ans.CompletionTokens,
+		},
+	})
+}
+
+// callUntilStop is CallChat for a request with stop sequences. It streams so
+// generation can be cut off at the first match, and returns the answer up to
+// it along with the matched sequence ("" if the model stopped by itself).
+func (s *Server) callUntilStop(ctx context.Context, backend llm.Backend, msgs []llm.Message, upstream string, p llm.Params, stops []string, promptTokens int) (*llm.ChatResponse, string, error) {
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	chunks, err := s.openStream(sctx, backend, msgs, upstream, p, promptTokens)
+	if err != nil {
+		return nil, "", err
+	}
+	sc := stopScanner{seqs: stops}
+	ans := &llm.ChatResponse{}
+	var text strings.Builder
+	done := false
+	for chunk := range chunks {
+		if sc.matched != "" {
+			continue
+		}
+		if chunk.Err != nil {
+			return nil, "", chunk.Err
+		}
+		if len(chunk.ToolCalls) > 0 {
+			text.WriteString(sc.flush())
+			ans.ToolCalls = append(ans.ToolCalls, chunk.ToolCalls...)
+		}
+		ans.Thinking += chunk.Thinking
+		text.WriteString(sc.feed(chunk.Content))
+		if sc.matched != "" {
+			cancel()
+			continue
+		}
+		if chunk.Done {
+			done = true
+			ans.DoneReason = chunk.DoneReason
+			ans.PromptTokens, ans.CompletionTokens = chunk.PromptTokens, chunk.CompletionTokens
+		}
+	}
+	if sc.matched == "" {
+		if err := cutShort(ctx); err != nil && !done {
+			return nil, "", err
+		}
+		text.WriteString(sc.flush())
+	}
+	ans.Content = text.String()
+	if sc.matched != "" {
+		// cancelled before the backend counted tokens
+		ans.PromptTokens, ans.CompletionTokens = promptTokens, llm.EstimateTokens(ans.Content)
+	}
+	return ans, sc.matched, nil
+}
+
+// streamMessages emits the typed Anthropic SSE sequence:
+// message_start, content_block_start/delta/stop per block, message_delta, message_stop.
+// A failure after the stream has started ends it with an error event.
+func (s *Server) streamMessages(ctx context.Context, w http.ResponseWriter, msgID, model string, backend llm.Backend, upstream string, msgs []llm.Message, params llm.Params, stops []string, promptTokens int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAnthropicError(w, http.StatusInternalServerError, "api_error", "streaming not supported")
+		return
+	}
+	// cancelled once a stop sequence matches
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	chunks, err := s.openStream(sctx, backend, msgs, upstream, params, promptTokens)
+	if err != nil {
+		writeAnthropicUpstreamError(ctx, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	send := func(event string, data map[string]interface{}) {
+		data["type"] = event
+		b, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, string(b))
+		flusher.Flush()
+	}
+
+	send("message_start", map[string]interface{}{
+		"message": map[string]interface{}{
+			"id":            msgID,
+			"type":          "message",
+			"role":          "assistant",
+			"model":         model,
+			"content":       []interface{}{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         map[string]interface{}{"input_tokens": 0, "output_tokens": 0},
+		},
+	})
+	send("ping", map[string]interface{}{})
+
+	index := 0
+	textOpen := false
+	toolUse := false
+	var final llm.StreamChunk
+
+	fail := func(err error) {
+		e := requestError(ctx, err)
+		send("error", map[string]interface{}{
+			"error": map[string]interface{}{"type": anthropicErrorType(e.status), "message": e.Message},
+		})
+	}
+	sc := stopScanner{seqs: stops}
+	var text strings.Builder
+	emit := func(t string) {
+		if t == "" {
+			return
+		}
+		if !textOpen {
+			send("content_block_start", map[string]interface{}{
+				"index":         index,
+				"content_block": map[string]interface{}{"type": "text", "text": ""},
+			})
+			textOpen = true
+		}
+		text.WriteString(t)
+		send("content_block_delta", map[string]interface{}{
+			"index": index,
+			"delta": map[string]interface{}{"type": "text_delta", "text": t},
+		})
+	}
+	for chunk := range chunks {
+		if sc.matched != "" {
+			continue
+		}
+		if chunk.Err != nil {
+			fail(chunk.Err)
+			return
+		}
+		if len(chunk.ToolCalls) > 0 {
+			emit(sc.flush())
+		}
+		emit(sc.feed(chunk.Content))
+		if sc.matched != "" {
+			cancel()
+			continue
+		}
+		for i, tc := range chunk.ToolCalls {
+			if textOpen {
+				send("content_block_stop", map[string]interface{}{"index": index})
+				index++
+				textOpen = false
+			}
+			block := toolUseBlock(i, tc)
+			args, _ := json.Marshal(block["input"])
+			block["input"] = map[string]interface{}{}
+			send("content_block_start", map[string]interface{}{"index": index, "content_block": block})
+			send("content_block_delta", map[string]interface{}{
+				"index": index,
+				"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": string(args)},
+			})
+			send("content_block_stop", map[string]interface{}{"index": index})
+			index++
+			toolUse = true
+		}
+		if chunk.Done {
+			final = chunk
+		}
+	}
+	if sc.matched == "" {
+		// a message cut off by preemption must not look complete
+		if err := cutShort(ctx); err != nil && !final.Done {
+			fail(err)
+			return
+		}
+		emit(sc.flush())
+	} else {
+		// cancelled before the backend counted tokens
+		final.PromptTokens, final.CompletionTokens = promptTokens, llm.EstimateTokens(text.String())
+	}
+	if textOpen {
+		send("content_block_stop", map[string]interface{}{"index": index})
+	}
+
+	send("message_delta", map[string]interface{}{
+		"delta": map[string]interface{}{
+			"stop_reason":   anthropicStopReason(final.DoneReason, toolUse, sc.matched),
+			"stop_sequence": stopSequence(sc.matched),
+		},
+		"usage": map[string]interface{}{
+			"input_tokens":  final.PromptTokens,
+			"output_tokens": final.CompletionTokens,
+		},
+	})
+	send("message_stop", map[string]interface{}{})
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/calvarado2004/LlamaMux/internal/audio"
+	"github.com/calvarado2004/LlamaMux/internal/cache"
+	"github.com/calvarado2004/LlamaMux/internal/tts"
+	"github.com/calvarado2004/LlamaMux/internal/upstream"
+)
+
+const maxAudioUploadBytes = 25 << 20
+
+func (s *Server) handleAudioTranscriptions(w http.ResponseWriter, r *http.Request) {
+	s.transcribe(w, r, false)
+}
+
+func (s *Server) handleAudioTranslations(w http.ResponseWriter, r *http.Request) {
+	s.transcribe(w, r, true)
+}
+
+func (s *Server) transcribe(w http.ResponseWriter, r *http.Request, translate bool) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST with a multipart body")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAudioUploadBytes)
+	if err := r.ParseMultipartForm(maxAudioUploadBytes); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid multipart body: %v", err))
+		return
+	}
+	f, hdr, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format := r.FormValue("response_format")
+	if format == "" {
+		format = "json"
+	}
+	switch format {
+	case "json", "text", "srt", "vtt", "verbose_json":
+	default:
+		writeError(w, http.StatusBadRequest, "response_format must be one of json, text, srt, vtt, verbose_json")
+		return
+	}
+
+	req := audio.Request{
+		Audio:     data,
+		Filename:  hdr.Filename,
+		Model:     r.FormValue("model"),
+		Language:  r.FormValue("language"),
+		Prompt:    r.FormValue("prompt"),
+		Translate: translate,
+	}
+	if v := r.FormValue("temperature"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "temperature must be a number")
+			return
+		}
+		req.Temperature = &t
+	}
+
+	t, err := s.audio.Transcribe(r.Context(), req)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	writeTranscription(w, t, format)
+}
+
+// transcript returns the text of an audio clip, cached by content hash
+func (s *Server) transcript(ctx context.Context, data []byte, filename string) (string, error) {
+	key := cache.Key(data)
+	if b, ok := s.audioCache.Get(key); ok {
+		return string(b), nil
+	}
+	t, err := s.audio.Transcribe(ctx, audio.Request{Audio: data, Filename: filename})
+	if err != nil {
+		return "", err
+	}
+	s.audioCache.Put(key, []byte(t.Text))
+	return t.Text, nil
+}
+
+func writeTranscription(w http.ResponseWriter, t *audio.Transcription, format string) {
+	switch format {
+	case "text":
+		writeText(w, t.Text+"\n")
+	case "srt":
+		writeText(w, t.SRT())
+	case "vtt":
+		writeText(w, t.VTT())
+	case "verbose_json":
+		writeJSON(w, http.StatusOK, t)
+	default:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"text": t.Text})
+	}
+}
+
+func writeText(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, body)
+}
+
+var audioContentTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"opus": "audio/opus",
+	"aac":  "audio/aac",
+	"flac": "audio/flac",
+	"wav":  "audio/wav",
+	"pcm":  "audio/pcm",
+}
+
+func (s *Server) handleAudioSpeech(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST for /v1/audio/speech")
+		return
+	}
+	var req SpeechRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if strings.TrimSpace(req.Input) == "" {
+		writeError(w, http.StatusBadRequest, "input is required for /v1/audio/speech")
+		return
+	}
+	if len(req.Input) > 4096 {
+		writeError(w, http.StatusBadRequest, "input must be at most 4096 characters")
+		return
+	}
+	speed := 1.0
+	if req.Speed != nil {
+		speed = *req.Speed
+	}
+	if speed < 0.25 || speed > 4.0 {
+		writeError(w, http.StatusBadRequest, "speed must be between 0.25 and 4.0")
+		return
+	}
+
+	native := s.tts.NativeFormats()
+	format := req.ResponseFormat
+	if format == "" {
+		format = native[0]
+	}
+	if _, ok := audioContentTypes[format]; !ok {
+		writeError(w, http.StatusBadRequest, "response_format must be one of mp3, opus, aac, flac, wav, pcm")
+		return
+	}
+	backendFormat := format
+	transcode := false
+	switch {
+	case slices.Contains(native, format):
+	case format == "pcm" && slices.Contains(native, "wav"):
+		backendFormat = "wav"
+	case s.tts.CanTranscode(format) && slices.Contains(native, "wav"):
+		backendFormat = "wav"
+		transcode = true
+	}
+	if !slices.Contains(native, backendFormat) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("response_format %s is not supported by the %s TTS backend without ffmpeg", format, s.tts.API))
+		return
+	}
+
+	voice := req.Voice
+	if mapped, ok := s.cfg.TTSVoices[voice]; ok {
+		voice = mapped
+	}
+	if voice == "" {
+		voice = s.cfg.TTSDefaultVoice
+	}
+
+	body, err := s.tts.Speak(r.Context(), tts.Request{
+		Model:  req.Model,
+		Input:  req.Input,
+		Voice:  voice,
+		Speed:  speed,
+		Format: backendFormat,
+	})
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	defer body.Close()
+
+	var src io.Reader = body
+	if format == "pcm" && backendFormat == "wav" {
+		info, rest, err := tts.StripWAVHeader(body)
+		if err != nil {
+			writeUpstreamError(w, upstream.BadResponse("TTS", err))
+			return
+		}
+		w.Header().Set("X-Sample-Rate", strconv.Itoa(info.SampleRate))
+		w.Header().Set("X-Channels", strconv.Itoa(info.Channels))
+		w.Header().Set("X-Bits-Per-Sample", strconv.Itoa(info.BitsPerSample))
+		src = rest
+	}
+	if transcode {
+		out, err := s.tts.Transcode(r.Context(), body, format)
+		if err != nil {
+			writeUpstreamError(w, upstream.BadResponse("TTS", err))
+			return
+		}
+		defer out.Close()
+		src = out
+	}
+
+	// the first read happens before the status is sent, so a backend or
+	// ffmpeg that fails straight away is still reported as an error
+	buf := make([]byte, 32<<10)
+	n, err := io.ReadAtLeast(src, buf, 1)
+	if err != nil {
+		writeUpstreamError(w, upstream.BadResponse("TTS", err))
+		return
+	}
+	w.Header().Set("Content-Type", audioContentTypes[format])
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for {
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+		n, err = src.Read(buf)
+	}
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/calvarado2004/LlamaMux/internal/batch"
+	"github.com/calvarado2004/LlamaMux/internal/files"
+)
+
+// Batches (/v1/batches) run a JSONL file of requests in the background, like
+// OpenAI's Batch API. Each line goes through the same handler as a live
+// request, at batch priority, and is retried while the gateway's queue turns
+// it away or interactive traffic preempts it.
+
+var batchEndpoints = []string{"/v1/chat/completions", "/v1/completions", "/v1/responses"}
+
+// batchAttempts bounds how often a line is tried while the gateway is busy;
+// retries back off from 1s to 30s, so a line gives up after about 20 minutes
+const batchAttempts = 45
+
+func (s *Server) batchHandler(endpoint string) http.HandlerFunc {
+	switch endpoint {
+	case "/v1/chat/completions":
+		return s.handleChatCompletions
+	case "/v1/completions":
+		return s.handleCompletions
+	case "/v1/responses":
+		return s.handleResponses
+	}
+	return nil
+}
+
+// runBatchRequest answers one batch line through the endpoint's handler
+func (s *Server) runBatchRequest(ctx context.Context, batchID, owner, endpoint string, body json.RawMessage) (int, json.RawMessage) {
+	h := s.batchHandler(endpoint)
+	if h == nil {
+		return http.StatusBadRequest, mustJSON(map[string]interface{}{"error": newAPIError(http.StatusBadRequest, "unsupported endpoint "+endpoint)})
+	}
+	// batch answers are collected whole, never streamed
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err == nil {
+		delete(fields, "stream")
+		delete(fields, "stream_options")
+		body, _ = json.Marshal(fields)
+	}
+
+	// file_id references resolve against the batch owner's files
+	ctx = withOwner(ctx, owner)
+	for attempt := 1; ; attempt++ {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Priority", "batch")
+		// each batch queues as its own client
+		req.RemoteAddr = batchID
+		rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		h(rec, req)
+
+		out := bytes.TrimSpace(rec.body.Bytes())
+		if !gatewayBusy(rec.status, out) || attempt == batchAttempts {
+			return rec.status, out
+		}
+		select {
+		case <-ctx.Done():
+			return rec.status, out
+		case <-time.After(min(time.Second<<min(attempt-1, 5), 30*time.Second)):
+		}
+	}
+}
+
+// gatewayBusy reports an answer from the admission controller rather than
+// the model: a full queue, a queue timeout or preemption
+func gatewayBusy(status int, body []byte) bool {
+	if status != http.StatusTooManyRequests && status != http.StatusServiceUnavailable {
+		return false
+	}
+	var e struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &e)
+	switch e.Error.Code {
+	case "queue_full", "queue_timeout", "preempted":
+		return true
+	}
+	return false
+}
+
+// bufferedResponse collects a handler's answer in memory
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if !b.wrote {
+		b.status, b.wrote = status, true
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wrote = true
+	return b.body.Write(p)
+}
+
+func mustJSON(v interface{}) json.RawMessage {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+type batchRequest struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+func (s *Server) handleBatches(w http.ResponseWriter, r *http.Request) {
+	if s.batches == nil {
+		writeError(w, http.StatusServiceUnavailable, "batches are unavailable; check DATA_DIR")
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		var req batchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+		if req.CompletionWindow == "" {
+			req.CompletionWindow = batch.Window
+		}
+		b, err := s.batches.Create(fileOwner(r), req.InputFileID, req.Endpoint, req.CompletionWindow, req.Metadata)
+		if errors.Is(err, files.ErrNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, b)
+
+	case http.MethodGet:
+		limit := 20
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 100 {
+				writeError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+				return
+			}
+			limit = n
+		}
+		list, more := s.batches.List(fileOwner(r), r.URL.Query().Get("after"), limit)
+		resp := map[string]interface{}{"object": "list", "data": list, "has_more": more}
+		if len(list) > 0 {
+			resp["first_id"], resp["last_id"] = list[0].ID, list[len(list)-1].ID
+		}
+		writeJSON(w, http.StatusOK, resp)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleBatch serves GET /v1/batches/{id} and POST /v1/batches/{id}/cancel
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if s.batches == nil {
+		writeError(w, http.StatusServiceUnavailable, "batches are unavailable; check DATA_DIR")
+		return
+	}
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/batches/"), "/")
+	var (
+		b   *batch.Batch
+		err error
+	)
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		b, err = s.batches.Get(fileOwner(r), id)
+	case action == "cancel" && r.Method == http.MethodPost:
+		b, err = s.batches.Cancel(fileOwner(r), id)
+	case action == "" || action == "cancel":
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	default:
+		writeError(w, http.StatusNotFound, "unknown batches path: "+r.URL.Path)
+		return
+	}
+	if errors.Is(err, batch.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no such batch: %s", id))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
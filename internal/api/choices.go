@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/calvarado2004/LlamaMux/internal/admission"
+	"github.com/calvarado2004/LlamaMux/internal/llm"
+)
+
+// Fan-out for n > 1: every choice is an independent generation. The
+// request's own admission slot runs choices one after another, and every
+// further choice asks the admission controller for a slot of its own, so
+// choices run side by side only as far as the model's and backend's limits
+// allow.
+
+// runChoices calls choice for every i in [0, n), each under the context of
+// the slot it runs in. Slot requests still queued once every choice has
+// started are withdrawn.
+func (s *Server) runChoices(ctx context.Context, slot admission.Request, n int, choice func(ctx context.Context, i int)) {
+	var next atomic.Int64
+	work := func(ctx context.Context) {
+		for i := int(next.Add(1)) - 1; i < n; i = int(next.Add(1)) - 1 {
+			choice(ctx, i)
+		}
+	}
+
+	var mu sync.Mutex
+	queued := map[int]context.CancelFunc{}
+	var wg sync.WaitGroup
+	for k := 1; k < n; k++ {
+		qctx, cancel := context.WithCancel(ctx)
+		mu.Lock()
+		queued[k] = cancel
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			admitted, release, err := s.admission.Acquire(qctx, slot)
+			mu.Lock()
+			delete(queued, k)
+			mu.Unlock()
+			if err != nil {
+				return
+			}
+			defer release()
+			work(admitted)
+		}()
+	}
+	work(ctx)
+	mu.Lock()
+	for _, cancel := range queued {
+		cancel()
+	}
+	mu.Unlock()
+	wg.Wait()
+}
+
+// indexedChunk is a stream chunk tagged with its choice index; end is set
+// once after that choice's stream has closed.
+type indexedChunk struct {
+	index int
+	chunk llm.StreamChunk
+	end   bool
+}
+
+// fanOutStream streams n choices (see openStream and runChoices) merged into
+// one channel. It fails, before any output, if the first stream cannot be
+// started; a later choice that fails or is cut short ends with an error chunk.
+func (s *Server) fanOutStream(ctx context.Context, slot admission.Request, backend llm.Backend, msgs []llm.Message, model string, p llm.Params, promptTokens, n int) (<-chan indexedChunk, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	merged := make(chan indexedChunk)
+	opened := make(chan error, 1)
+	var once sync.Once
+	go func() {
+		defer close(merged)
+		defer cancel()
+		s.runChoices(ctx, slot, n, func(ctx context.Context, i int) {
+			ch, err := s.openStream(ctx, backend, msgs, model, p, promptTokens)
+			once.Do(func() { opened <- err })
+			if err != nil {
+				merged <- indexedChunk{index: i, chunk: llm.StreamChunk{Err: err}}
+				merged <- indexedChunk{index: i, end: true}
+				return
+			}
+			done := false
+			for c := range ch {
+				done = done || c.Done
+				merged <- indexedChunk{index: i, chunk: c}
+			}
+			if err := cutShort(ctx); err != nil && !done {
+				merged <- indexedChunk{index: i, chunk: llm.StreamChunk{Err: err}}
+			}
+			merged <- indexedChunk{index: i, end: true}
+		})
+	}()
+	if err := <-opened; err != nil {
+		cancel()
+		for range merged {
+		}
+		return nil, err
+	}
+	return merged, nil
+}
+
+// chatChoices runs n non-streaming generations and returns them in index
+// order; the first error wins and stops the rest.
+func (s *Server) chatChoices(ctx context.Context, slot admission.Request, backend llm.Backend, msgs []llm.Message, model string, p llm.Params, f *outputFormat, n int) ([]*llm.ChatResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]*llm.ChatResponse, n)
+	var mu sync.Mutex
+	var firstErr error
+	s.runChoices(ctx, slot, n, func(ctx context.Context, i int) {
+		ans, err := s.callStructured(ctx, backend, msgs, model, p, f)
+		if err != nil && ctx.Err() != nil {
+			// a preempted slot only shows up as a cancellation
+			err = context.Cause(ctx)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil && firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+		results[i] = ans
+	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// usageOf aggregates token counts over choices. The prompt is the same for
+// every choice, so it is counted once.
+func usageOf(promptTokens int, completionTokens int) map[string]interface{} {
+	return map[string]interface{}{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": completionTokens,
+		"total_tokens":      promptTokens + completionTokens,
+	}
+}
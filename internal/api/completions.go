@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/calvarado2004/LlamaMux/internal/llm"
+)
+
+// stringList accepts a string or an array of strings
+func stringList(v interface{}) ([]string, bool) {
+	switch t := v.(type) {
+	case nil:
+		return nil, true
+	case string:
+		return []string{t}, true
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, s)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func completionFinish(doneReason string) string {
+	if doneReason == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+// handleCompletions serves the legacy text completions API. Each prompt is
+// sent to the backend as a raw completion (no chat template); with a suffix
+// the model's fill-in-the-middle template is used instead.
+func (s *Server) handleCompletions(w http.ResponseWriter, r *http.Request) {
+	var reqBody CompletionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if reqBody.Model == "" {
+		writeError(w, http.StatusBadRequest, "model is required for /v1/completions")
+		return
+	}
+	prompts, ok := stringList(reqBody.Prompt)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "prompt must be a string or an array of strings (token arrays are not supported)")
+		return
+	}
+	if len(prompts) == 0 {
+		prompts = []string{""}
+	}
+	stop, ok := stringList(reqBody.Stop)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "stop must be a string or an array of strings")
+		return
+	}
+
+	backend, upstream := s.backendFor(reqBody.Model)
+	completer, ok := backend.(llm.Completer)
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("model %q is served by a backend without text completion support", reqBody.Model))
+		return
+	}
+	admitted, release, aerr := s.admit(w, r, reqBody.Model)
+	if aerr != nil {
+		writeAPIError(w, aerr)
+		return
+	}
+	defer release()
+	r = r.WithContext(admitted)
+
+	params := llm.Params{
+		MaxTokens:   reqBody.MaxTokens,
+		Stop:        stop,
+		Temperature: reqBody.Temperature,
+		TopP:        reqBody.TopP,
+	}
+	// every prompt is checked against the window and gets its own num_ctx;
+	// the headers describe the largest
+	reqs := make([]llm.CompletionRequest, len(prompts))
+	var largest contextInfo
+	for i, prompt := range prompts {
+		p := params
+		text := []llm.Message{{Role: "user", Content: prompt + reqBody.Suffix}}
+		_, info, err := s.fitContext(r, backend, upstream, text, &p)
+		if err != nil {
+			writeAPIError(w, contextError(err))
+			return
+		}
+		if info.promptTokens >= largest.promptTokens {
+			largest = info
+		}
+		reqs[i] = llm.CompletionRequest{Prompt: prompt, Suffix: reqBody.Suffix, Params: p}
+	}
+	largest.writeHeaders(w)
+	id := fmt.Sprintf("cmpl_%d", time.Now().UnixMilli())
+
+	if reqBody.Stream {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, "streaming not supported")
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		send := func(index int, text string, finish interface{}) {
+			chunk := map[string]interface{}{
+				"id":      id,
+				"object":  "text_completion",
+				"created": NowTS(),
+				"model":   reqBody.Model,
+				"choices": []interface{}{
+					map[string]interface{}{
+						"index":         index,
+						"text":          text,
+						"logprobs":      nil,
+						"finish_reason": finish,
+					},
+				},
+			}
+			b, _ := json.Marshal(chunk)
+			fmt.Fprintf(w, "data: %s\n\n", string(b))
+			flusher.Flush()
+		}
+
+		for i, prompt := range prompts {
+			if reqBody.Echo && prompt != "" {
+				send(i, prompt, nil)
+			}
+			finish := "stop"
+			var failure error
+			done := false
+			for chunk := range completer.StreamComplete(r.Context(), upstream, reqs[i]) {
+				if chunk.Err != nil {
+					failure = chunk.Err
+					continue
+				}
+				if chunk.Content != "" {
+					send(i, chunk.Content, nil)
+				}
+				if chunk.Done {
+					finish = completionFinish(chunk.DoneReason)
+					done = true
+				}
+			}
+			if failure == nil && !done {
+				failure = cutShort(r.Context())
+			}
+			if failure != nil {
+				writeStreamError(w, requestError(r.Context(), failure))
+				break
+			}
+			send(i, "", finish)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+		return
+	}
+
+	var choices []interface{}
+	var promptTokens, completionTokens int
+	for i, prompt := range prompts {
+		ans, err := completer.Complete(r.Context(), upstream, reqs[i])
+		if err != nil {
+			writeAPIError(w, requestError(r.Context(), err))
+			return
+		}
+		text := ans.Content
+		if reqBody.Echo {
+			text = prompt + text
+		}
+		choices = append(choices, map[string]interface{}{
+			"index":         i,
+			"text":          text,
+			"logprobs":      nil,
+			"finish_reason": completionFinish(ans.DoneReason),
+		})
+		promptTokens += ans.PromptTokens
+		completionTokens += ans.CompletionTokens
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":      id,
+		"object":  "text_completion",
+		"created": NowTS(),
+		"model":   reqBody.Model,
+		"choices": choices,
+		"usage": map[string]interface{}{
+			"prompt_tokens":     promptTokens,
+			"completion_tokens": completionTokens,
+			"total_tokens":      promptTokens + completionTokens,
+		},
+	})
+}
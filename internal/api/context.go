@@ -0,0 +1,172 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/calvarado2004/LlamaMux/internal/llm"
+	"github.com/calvarado2004/LlamaMux/internal/ollama"
+)
+
+// Context management: estimate the prompt, trim (or summarize) the
+// conversation to the model's window per CONTEXT_STRATEGY, and pick num_ctx. What happened is
+// reported in response headers, never in the answer text.
+//
+// On Ollama backends num_ctx starts at OLLAMA_NUM_CTX and doubles until the
+// prompt plus the answer reserve fits, so Ollama only reloads a model when a
+// request actually needs a larger window. Other backends size their window
+// themselves.
+
+type contextInfo struct {
+	window       int // model max context, 0 if unknown
+	numCtx       int // 0 for backends without num_ctx
+	promptTokens int
+	dropped      int
+	summarized   int
+}
+
+func (c contextInfo) writeHeaders(w http.ResponseWriter) {
+	h := w.Header()
+	if c.numCtx > 0 {
+		h.Set("X-Context-Num-Ctx", strconv.Itoa(c.numCtx))
+	}
+	h.Set("X-Context-Prompt-Tokens", strconv.Itoa(c.promptTokens))
+	if c.dropped > 0 {
+		h.Set("X-Context-Dropped-Messages", strconv.Itoa(c.dropped))
+	}
+	if c.summarized > 0 {
+		h.Set("X-Context-Summarized-Messages", strconv.Itoa(c.summarized))
+	}
+}
+
+// fitContext trims msgs and sets p.NumCtx. It fails only when the prompt
+// cannot be made to fit, e.g. a single oversized message. r is the admitted
+// request the messages belong to.
+func (s *Server) fitContext(r *http.Request, backend llm.Backend, model string, msgs []llm.Message, p *llm.Params) ([]llm.Message, contextInfo, error) {
+	ctx := r.Context()
+	var info contextInfo
+	if sizer, ok := backend.(llm.ContextSizer); ok {
+		info.window, _ = sizer.ContextLength(ctx, model)
+	}
+	if s.cfg.ContextMax > 0 && (info.window == 0 || info.window > s.cfg.ContextMax) {
+		info.window = s.cfg.ContextMax
+	}
+
+	reserve := p.MaxTokens
+	if reserve <= 0 {
+		reserve = s.cfg.ContextReserve
+	}
+	fixed := llm.EstimateTools(p.Tools)
+	budget := 0
+	if info.window > 0 {
+		budget = info.window - reserve - fixed
+	}
+
+	strategy := s.cfg.ContextStrategy
+	if strategy == "summarize" && budget > 0 && budget <= s.cfg.SummaryMaxTokens {
+		// a summary would take the whole window, so drop turns instead
+		strategy = "drop_oldest"
+	}
+	if strategy == "summarize" && budget > 0 {
+		// leave room for the summary that replaces the oldest turns
+		system, dropped, kept := truncate(msgs, "drop_oldest", 0, budget-s.cfg.SummaryMaxTokens)
+		if len(dropped) > 0 {
+			summary, err := s.summarize(r, backend, model, dropped)
+			withSummary := joinMessages(system, []llm.Message{summary}, kept)
+			if err == nil && llm.EstimateMessages(withSummary) > budget {
+				err = fmt.Errorf("summary does not fit the context window")
+			}
+			if err == nil {
+				msgs = withSummary
+				info.summarized = len(dropped)
+			} else {
+				log.Printf("summarize: %v; dropping %d messages instead", err, len(dropped))
+				msgs = joinMessages(system, kept)
+				info.dropped = len(dropped)
+			}
+		}
+	} else {
+		system, dropped, kept := truncate(msgs, strategy, s.cfg.ContextKeepLast, budget)
+		if len(dropped) > 0 {
+			msgs = joinMessages(system, kept)
+			info.dropped = len(dropped)
+		}
+	}
+	info.promptTokens = llm.EstimateMessages(msgs) + fixed
+
+	need := info.promptTokens + reserve
+	if info.window > 0 && need > info.window && s.cfg.ContextStrategy != "none" {
+		return nil, info, fmt.Errorf("prompt is about %d tokens; %s accepts %d including %d reserved for the answer",
+			info.promptTokens, model, info.window, reserve)
+	}
+
+	if _, ok := backend.(*ollama.Client); !ok {
+		return msgs, info, nil
+	}
+	n := max(s.cfg.OllamaNumCtx, 1)
+	for n < need && (info.window == 0 || n < info.window) {
+		n *= 2
+	}
+	if info.window > 0 && n > info.window {
+		n = info.window
+	}
+	info.numCtx = n
+	p.NumCtx = n
+	return msgs, info, nil
+}
+
+// truncate applies the strategy and returns the pinned system messages, the
+// dropped messages and the kept ones. Leading system messages are always
+// kept, as is the last message; tool results are dropped together with the
+// call that produced them. budget <= 0 means the window is unknown.
+func truncate(msgs []llm.Message, strategy string, keepLast, budget int) (system, dropped, kept []llm.Message) {
+	pinned := 0
+	for pinned < len(msgs) && msgs[pinned].Role == "system" {
+		pinned++
+	}
+	system, rest := msgs[:pinned], msgs[pinned:]
+	if strategy == "none" {
+		return system, nil, rest
+	}
+
+	cost := make([]int, len(rest))
+	total := llm.EstimateMessages(system)
+	for i := range rest {
+		cost[i] = llm.EstimateMessages(rest[i : i+1])
+		total += cost[i]
+	}
+
+	start := 0
+	drop := func() {
+		total -= cost[start]
+		start++
+		for start < len(rest)-1 && rest[start].Role == "tool" {
+			total -= cost[start]
+			start++
+		}
+	}
+
+	if strategy == "keep_last" && keepLast > 0 {
+		for len(rest)-start > keepLast && start < len(rest)-1 {
+			drop()
+		}
+	}
+	for budget > 0 && total > budget && start < len(rest)-1 {
+		drop()
+	}
+	return system, rest[:start], rest[start:]
+}
+
+func joinMessages(parts ...[]llm.Message) []llm.Message {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	out := make([]llm.Message, 0, n)
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/calvarado2004/LlamaMux/internal/document"
+	"github.com/calvarado2004/LlamaMux/internal/ocr"
+)
+
+// pageText is the text of one document page, embedded or recognised
+type pageText struct {
+	Number int
+	Source string
+	Text   string
+	OCR    *ocr.Result
+	Err    error
+}
+
+// fileFromPart reads the payload of a chat "file" part or a Responses
+// "input_file" part: inline data, a URL or the file_id of an upload. The
+// filename is empty when the part has none.
+func fileFromPart(part map[string]interface{}) (src, filename string) {
+	fields := part
+	if f, ok := part["file"].(map[string]interface{}); ok {
+		fields = f
+	}
+	filename, _ = fields["filename"].(string)
+	for _, k := range []string{"file_data", "file_url", "url", "file_id"} {
+		if v, ok := fields[k].(string); ok && v != "" {
+			return v, filename
+		}
+	}
+	return "", filename
+}
+
+func (s *Server) docLimits() document.Limits {
+	return document.Limits{
+		MaxPages: s.cfg.DocMaxPages,
+		MaxBytes: int64(s.cfg.DocMaxBytes),
+	}
+}
+
+// readPages OCRs the pages that have no embedded text, a few at a time
+func (s *Server) readPages(ctx context.Context, pages []document.Page) []pageText {
+	out := make([]pageText, len(pages))
+	sem := make(chan struct{}, max(1, s.cfg.DocOCRConcurrency))
+	var wg sync.WaitGroup
+
+	for i, p := range pages {
+		out[i] = pageText{Number: p.Number, Source: "embedded", Text: p.Text}
+		if p.Image == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, p document.Page) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res, err := s.recognize(ctx, p.Image, p.ImageName)
+			out[i].Source = "ocr"
+			out[i].OCR = res
+			out[i].Err = err
+			if err == nil {
+				out[i].Text = res.Text
+			}
+		}(i, p)
+	}
+	wg.Wait()
+	return out
+}
+
+// documentText turns an attached file into page-labelled prompt text
+func (s *Server) documentText(ctx context.Context, data []byte, filename string) string {
+	if document.Detect(data) == "" {
+		ct := http.DetectContentType(data)
+		switch {
+		case strings.HasPrefix(ct, "image/"):
+			res, err := s.recognize(ctx, data, "")
+			if err != nil {
+				return fmt.Sprintf("[File: %s]\n[%v]", filename, err)
+			}
+			return fmt.Sprintf("[File: %s]\n%s", filename, res.Text)
+		case strings.HasPrefix(ct, "text/") && utf8.Valid(data):
+			return fmt.Sprintf("[File: %s]\n%s", filename, string(data))
+		}
+		return fmt.Sprintf("[File: %s]\n[Unsupported file type %s]", filename, ct)
+	}
+
+	doc, err := document.Split(data, s.docLimits())
+	if err != nil {
+		return fmt.Sprintf("[File: %s]\n[Could not read document: %v]", filename, err)
+	}
+	// parsing is not interruptible; give up before OCR if it ran too long
+	if err := context.Cause(ctx); err != nil {
+		return fmt.Sprintf("[File: %s]\n[Could not read document: %v]", filename, err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[Document: %s, %d pages]", filename, doc.TotalPages)
+	for _, p := range s.readPages(ctx, doc.Pages) {
+		switch {
+		case p.Err != nil:
+			fmt.Fprintf(&sb, "\n\n[Page %d]\n[%v]", p.Number, p.Err)
+		case strings.TrimSpace(p.Text) == "":
+			fmt.Fprintf(&sb, "\n\n[Page %d]\n[No text found]", p.Number)
+		default:
+			fmt.Fprintf(&sb, "\n\n[Page %d]\n%s", p.Number, strings.TrimSpace(p.Text))
+		}
+	}
+	if doc.Truncated() {
+		fmt.Fprintf(&sb, "\n\n[Document truncated: first %d of %d pages]", len(doc.Pages), doc.TotalPages)
+	}
+	return sb.String()
+}
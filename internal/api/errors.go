@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/calvarado2004/LlamaMux/internal/admission"
+	"github.com/calvarado2004/LlamaMux/internal/upstream"
+)
+
+// Errors use the OpenAI shape, {"error": {"message", "type", "param", "code"}},
+// which the OpenAI SDKs turn into typed exceptions. Upstream failures are
+// answered with the status their kind maps to (see upstream.Kind.Status).
+
+type apiError struct {
+	status  int
+	Message string      `json:"message"`
+	Type    string      `json:"type"`
+	Param   interface{} `json:"param"`
+	Code    interface{} `json:"code"`
+}
+
+func newAPIError(status int, msg string) *apiError {
+	e := &apiError{status: status, Message: msg, Type: "invalid_request_error"}
+	switch {
+	case status == http.StatusUnauthorized:
+		e.Type = "authentication_error"
+	case status == http.StatusForbidden:
+		e.Type = "permission_error"
+	case status == http.StatusTooManyRequests:
+		e.Type = "rate_limit_error"
+	case status >= 500:
+		e.Type = "server_error"
+	}
+	return e
+}
+
+// upstreamError classifies err; anything that is not an upstream failure
+// (or a preempted batch request) is a 500
+func upstreamError(err error) *apiError {
+	if errors.Is(err, admission.ErrPreempted) {
+		e := newAPIError(http.StatusServiceUnavailable, err.Error())
+		e.Code = "preempted"
+		return e
+	}
+	kind, ok := upstream.KindOf(err)
+	if !ok {
+		return newAPIError(http.StatusInternalServerError, err.Error())
+	}
+	e := newAPIError(kind.Status(), err.Error())
+	switch kind {
+	case upstream.ContextOverflow:
+		e.Code = "context_length_exceeded"
+	case upstream.ModelNotFound:
+		e.Code = "model_not_found"
+	case upstream.RateLimited:
+		e.Code = "rate_limit_exceeded"
+	case upstream.RequestTimeout:
+		e.Code = "request_timeout"
+	case upstream.Unavailable:
+		e.Type, e.Code = "upstream_error", "upstream_unavailable"
+	case upstream.Timeout:
+		e.Type, e.Code = "upstream_error", "upstream_timeout"
+	case upstream.Failed:
+		e.Type, e.Code = "upstream_error", "upstream_failed"
+	}
+	return e
+}
+
+// requestError is upstreamError for a failure of a request running under
+// ctx. Once ctx has been preempted the backend only sees a cancellation, so
+// the preemption is reported in its place.
+func requestError(ctx context.Context, err error) *apiError {
+	if cause := context.Cause(ctx); ctx.Err() != nil && errors.Is(cause, admission.ErrPreempted) {
+		err = cause
+	}
+	return upstreamError(err)
+}
+
+// cutShort is the error for a stream that ended without a final chunk
+// because ctx ended, or nil if ctx is still live
+func cutShort(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(ctx)
+}
+
+// contextError reports a prompt that cannot be fitted to the model's window
+func contextError(err error) *apiError {
+	e := newAPIError(http.StatusBadRequest, err.Error())
+	e.Code = "context_length_exceeded"
+	return e
+}
+
+func writeAPIError(w http.ResponseWriter, e *apiError) {
+	writeJSON(w, e.status, map[string]interface{}{"error": e})
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeAPIError(w, newAPIError(status, msg))
+}
+
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	writeAPIError(w, upstreamError(err))
+}
+
+// writeStreamError emits an error event inside an SSE stream that has
+// already started
+func writeStreamError(w http.ResponseWriter, e *apiError) {
+	b, _ := json.Marshal(map[string]interface{}{"error": e})
+	fmt.Fprintf(w, "event: error\ndata: %s\n\n", string(b))
+}
+
+// admissionError reports a request the admission controller turned away:
+// 429 when the queue is full, 503 when it waited too long
+func admissionError(err error) *apiError {
+	switch {
+	case errors.Is(err, admission.ErrQueueFull):
+		e := newAPIError(http.StatusTooManyRequests, err.Error())
+		e.Code = "queue_full"
+		return e
+	case errors.Is(err, admission.ErrQueueTimeout):
+		e := newAPIError(http.StatusServiceUnavailable, err.Error())
+		e.Code = "queue_timeout"
+		return e
+	}
+	return newAPIError(http.StatusServiceUnavailable, err.Error())
+}
+
+// formatError reports streamed output that does not match response_format
+func formatError(err error) *apiError {
+	e := newAPIError(http.StatusInternalServerError, err.Error())
+	e.Code = "invalid_response_format"
+	return e
+}
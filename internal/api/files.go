@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/calvarado2004/LlamaMux/internal/files"
+)
+
+// Uploaded files live under DATA_DIR/files. They are inputs for /v1/batches
+// (purpose "batch"), the batches' output files ("batch_output"), and
+// documents or images that chat and Responses requests reference by
+// file_id ("user_data", "vision", "assistants").
+//
+// Files and batches belong to the API key that created them and are hidden
+// from every other key, as are the output files of a batch. Callers without
+// a key share one owner.
+
+// uploadPurposes are the purposes a client may upload with; batch_output
+// files are only written by batches
+var uploadPurposes = []string{"assistants", "batch", "user_data", "vision"}
+
+type ownerKey struct{}
+
+// fileOwner identifies the caller as the owner of files and batches: a hash
+// of the API key, so keys are not written to disk. Batch lines carry their
+// batch's owner in the context instead.
+func fileOwner(r *http.Request) string {
+	if owner, ok := r.Context().Value(ownerKey{}).(string); ok {
+		return owner
+	}
+	key := apiKey(r)
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func withOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+// owned runs h with the caller recorded as the owner of the files its
+// messages may reference by file_id
+func (s *Server) owned(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h(w, r.WithContext(withOwner(r.Context(), fileOwner(r))))
+	}
+}
+
+// ownFile returns the metadata of a file of owner; other owners' files are
+// not found
+func (s *Server) ownFile(owner, id string) (*files.File, error) {
+	f, err := s.files.Get(id)
+	if err == nil && f.Owner != owner {
+		return nil, files.ErrNotFound
+	}
+	return f, err
+}
+
+func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	if s.files == nil {
+		writeError(w, http.StatusServiceUnavailable, "file storage is unavailable; check DATA_DIR")
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		s.uploadFile(w, r)
+	case http.MethodGet:
+		s.listFiles(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, int64(s.cfg.FilesMaxBytes))
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid multipart body: %v", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	purpose := r.FormValue("purpose")
+	if !slices.Contains(uploadPurposes, purpose) {
+		writeError(w, http.StatusBadRequest, "purpose must be one of "+strings.Join(uploadPurposes, ", "))
+		return
+	}
+	f, hdr, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+	defer f.Close()
+
+	file, err := s.files.Create(hdr.Filename, purpose, fileOwner(r), f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, file)
+}
+
+func (s *Server) listFiles(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 10000
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 10000 {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and 10000")
+			return
+		}
+		limit = n
+	}
+	order := q.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		writeError(w, http.StatusBadRequest, `order must be "asc" or "desc"`)
+		return
+	}
+	list, more, err := s.files.List(fileOwner(r), q.Get("purpose"), q.Get("after"), limit, order == "asc")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp := map[string]interface{}{"object": "list", "data": list, "has_more": more}
+	if len(list) > 0 {
+		resp["first_id"], resp["last_id"] = list[0].ID, list[len(list)-1].ID
+	} else {
+		resp["data"] = []*files.File{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleFile serves GET and DELETE /v1/files/{id} and GET
+// /v1/files/{id}/content
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	if s.files == nil {
+		writeError(w, http.StatusServiceUnavailable, "file storage is unavailable; check DATA_DIR")
+		return
+	}
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/files/"), "/")
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		file, err := s.ownFile(fileOwner(r), id)
+		if err != nil {
+			writeFileError(w, id, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, file)
+
+	case action == "" && r.Method == http.MethodDelete:
+		if _, err := s.ownFile(fileOwner(r), id); err != nil {
+			writeFileError(w, id, err)
+			return
+		}
+		// a running batch reads its input again when it resumes or expires
+		if s.batches != nil && s.batches.InUse(id) {
+			writeError(w, http.StatusConflict, fmt.Sprintf("file %s is the input of an unfinished batch", id))
+			return
+		}
+		if err := s.files.Delete(id); err != nil {
+			writeFileError(w, id, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "object": "file", "deleted": true})
+
+	case action == "content" && r.Method == http.MethodGet:
+		if _, err := s.ownFile(fileOwner(r), id); err != nil {
+			writeFileError(w, id, err)
+			return
+		}
+		file, rc, err := s.files.Open(id)
+		if err != nil {
+			writeFileError(w, id, err)
+			return
+		}
+		defer rc.Close()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+		w.Header().Set("Content-Length", strconv.FormatInt(file.Bytes, 10))
+		io.Copy(w, rc)
+
+	case action == "" || action == "content":
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+	default:
+		writeError(w, http.StatusNotFound, "unknown files path: "+r.URL.Path)
+	}
+}
+
+func writeFileError(w http.ResponseWriter, id string, err error) {
+	if errors.Is(err, files.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no such file: %s", id))
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// readFile returns the contents and name of an uploaded file referenced by
+// file_id in a message part; the file must belong to the owner in ctx
+func (s *Server) readFile(ctx context.Context, id string) ([]byte, string, error) {
+	if s.files == nil {
+		return nil, "", errors.New("file storage is unavailable")
+	}
+	owner, _ := ctx.Value(ownerKey{}).(string)
+	if _, err := s.ownFile(owner, id); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", id, err)
+	}
+	file, rc, err := s.files.Open(id)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", id, err)
+	}
+	defer rc.Close()
+	if limit := s.cfg.DocMaxBytes; limit > 0 && file.Bytes > int64(limit) {
+		return nil, "", fmt.Errorf("%s is %d bytes, over the %d byte limit", id, file.Bytes, limit)
+	}
+	data, err := io.ReadAll(rc)
+	return data, file.Filename, err
+}
+
+// fileName is the name of an uploaded file of the owner in ctx, or
+// "document" for other sources
+func (s *Server) fileName(ctx context.Context, src string) string {
+	if files.IsID(src) && s.files != nil {
+		owner, _ := ctx.Value(ownerKey{}).(string)
+		if f, err := s.ownFile(owner, src); err == nil {
+			return f.Filename
+		}
+	}
+	return "document"
+}
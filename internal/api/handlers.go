@@ -1,48 +1,238 @@
 package api
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
+	"path/filepath"
 	"regexp"
+	"runtime/debug"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/calvarado2004/LlamaMux/internal/admission"
+	"github.com/calvarado2004/LlamaMux/internal/audio"
+	"github.com/calvarado2004/LlamaMux/internal/batch"
+	"github.com/calvarado2004/LlamaMux/internal/cache"
 	"github.com/calvarado2004/LlamaMux/internal/config"
+	"github.com/calvarado2004/LlamaMux/internal/fetch"
+	"github.com/calvarado2004/LlamaMux/internal/files"
+	"github.com/calvarado2004/LlamaMux/internal/llm"
 	"github.com/calvarado2004/LlamaMux/internal/ocr"
 	"github.com/calvarado2004/LlamaMux/internal/ollama"
+	"github.com/calvarado2004/LlamaMux/internal/openai"
 	"github.com/calvarado2004/LlamaMux/internal/sd"
+	"github.com/calvarado2004/LlamaMux/internal/tts"
 )
 
 type Server struct {
 	cfg    config.Config
 	ollama *ollama.Client
+	llm    *llm.Router
 	ocr    *ocr.Client
 	sd     *sd.Client
+	audio  *audio.Client
+	tts    *tts.Client
+
+	fetcher    *fetch.Fetcher
+	ocrCache   *cache.Cache
+	audioCache *cache.Cache
+	// summaries of dropped conversation turns, keyed by model and prefix
+	summaryCache *cache.Cache
+
+	// warm-up and hot model state, shown in /health
+	warm *warmer
+	// concurrency limits and request queue for the LLM backends
+	admission *admission.Controller
+	// uploaded files and background batches; nil if DATA_DIR is unusable
+	files   *files.Store
+	batches *batch.Manager
 }
 
 func NewServer(cfg config.Config) *Server {
-	return &Server{
-		cfg: cfg,
-		ollama: ollama.NewClient(ollama.Config{
-			BaseURL:    cfg.OllamaURL,
-			NumCtx:     cfg.OllamaNumCtx,
-			ServerName: cfg.ServerName,
+	allow, err := fetch.ParseAllowList(cfg.FetchAllow)
+	if err != nil {
+		log.Printf("ignoring FETCH_ALLOW: %v", err)
+	}
+
+	ollamaClient := ollama.NewClient(ollama.Config{
+		BaseURL:    cfg.OllamaURL,
+		NumCtx:     cfg.OllamaNumCtx,
+		ServerName: cfg.ServerName,
+		AutoPull:   cfg.AutoPull,
+		PullModels: pullModels(cfg, "ollama"),
+		KeepAlive:  cfg.ModelKeepAlive,
+	})
+
+	s := &Server{
+		cfg:    cfg,
+		ollama: ollamaClient,
+		llm:    newRouter(cfg, ollamaClient),
+		ocr:    ocr.NewClient(cfg.OCRURL),
+		sd:     sd.NewClient(cfg.SDWebUIURL),
+		audio:  audio.NewClient(cfg.WhisperURL),
+		tts:    tts.NewClient(cfg.TTSURL, cfg.TTSAPI),
+		admission: admission.New(admission.Config{
+			ModelLimit:     cfg.ModelConcurrency,
+			ModelLimits:    cfg.ModelConcurrencies,
+			BackendLimits:  cfg.BackendConcurrency,
+			MaxQueue:       cfg.QueueMax,
+			MaxQueuePerKey: cfg.QueueMaxPerKey,
+			QueueTimeout:   cfg.QueueTimeout,
+			BatchShare:     cfg.BatchMinShare,
+			Preempt:        cfg.PreemptBatch,
+		}),
+		fetcher: fetch.New(fetch.Config{
+			Timeout:      cfg.FetchTimeout,
+			MaxBytes:     int64(cfg.FetchMaxBytes),
+			MaxRedirects: cfg.FetchMaxRedirects,
+			Allow:        allow,
+		}),
+		ocrCache: cache.New(cache.Config{
+			MaxEntries: cfg.OCRCacheEntries,
+			TTL:        cfg.CacheTTL,
+			Dir:        cacheDir(cfg.CacheDir, "ocr"),
+		}),
+		audioCache: cache.New(cache.Config{
+			MaxEntries: cfg.AudioCacheEntries,
+			TTL:        cfg.CacheTTL,
+			Dir:        cacheDir(cfg.CacheDir, "audio"),
+		}),
+		summaryCache: cache.New(cache.Config{
+			MaxEntries: cfg.SummaryCacheEntries,
+			TTL:        cfg.CacheTTL,
+			Dir:        cacheDir(cfg.CacheDir, "summaries"),
 		}),
-		ocr: ocr.NewClient(cfg.OCRURL),
-		sd:  sd.NewClient(cfg.SDWebUIURL),
 	}
+	s.warm = s.startWarmup()
+	s.startBatches()
+	return s
+}
+
+// startBatches opens the file store and resumes unfinished batches
+func (s *Server) startBatches() {
+	dir, err := filepath.Abs(s.cfg.DataDir)
+	if err != nil {
+		log.Printf("files and batches disabled: %v", err)
+		return
+	}
+	if dir != s.cfg.DataDir {
+		log.Printf("DATA_DIR %q resolved to %s", s.cfg.DataDir, dir)
+	}
+	store, err := files.New(filepath.Join(dir, "files"))
+	if err != nil {
+		log.Printf("files and batches disabled: %v", err)
+		return
+	}
+	s.files = store
+	s.batches, err = batch.New(batch.Config{
+		Dir:         filepath.Join(dir, "batches"),
+		Endpoints:   batchEndpoints,
+		Concurrency: s.cfg.BatchConcurrency,
+		MaxLines:    s.cfg.BatchMaxLines,
+	}, store, s.runBatchRequest)
+	if err != nil {
+		log.Printf("batches disabled: %v", err)
+	}
+}
+
+// newRouter builds the LLM backends. Ollama is always present as the default
+// backend "ollama"; LLM_BACKENDS adds more as "name=type:url" where type is
+// "openai" or "ollama".
+func newRouter(cfg config.Config, def *ollama.Client) *llm.Router {
+	backends := map[string]llm.Backend{"ollama": def}
+	for name, spec := range cfg.LLMBackends {
+		kind, url, ok := strings.Cut(spec, ":")
+		if !ok || name == "ollama" {
+			log.Printf("ignoring LLM backend %q: %q", name, spec)
+			continue
+		}
+		switch kind {
+		case "openai":
+			backends[name] = openai.NewClient(url, cfg.LLMBackendKeys[name])
+		case "ollama":
+			backends[name] = ollama.NewClient(ollama.Config{BaseURL: url, NumCtx: cfg.OllamaNumCtx, ServerName: cfg.ServerName, AutoPull: cfg.AutoPull, PullModels: pullModels(cfg, name), KeepAlive: cfg.ModelKeepAlive})
+		default:
+			log.Printf("ignoring LLM backend %q: unknown type %q", name, kind)
+		}
+	}
+	for model, name := range cfg.ModelRoutes {
+		if _, ok := backends[name]; !ok {
+			log.Printf("MODEL_ROUTES: %q points at unknown backend %q", model, name)
+		}
+	}
+	return llm.NewRouter("ollama", backends, cfg.ModelRoutes)
+}
+
+// pullModels lists the models backend may auto-pull: the routes pointing at
+// it and the models named in OLLAMA_AUTO_PULL_MODELS, WARMUP_MODELS and
+// HOT_MODELS. A "<backend>/" prefix limits an entry to that backend.
+func pullModels(cfg config.Config, backend string) []string {
+	var out []string
+	for pattern, name := range cfg.ModelRoutes {
+		if name == backend {
+			out = append(out, pattern)
+		}
+	}
+	for _, list := range [][]string{cfg.AutoPullModels, cfg.WarmupModels, cfg.HotModels} {
+		for _, model := range list {
+			if prefix, rest, ok := strings.Cut(model, "/"); ok && (prefix == "ollama" || cfg.LLMBackends[prefix] != "") {
+				if prefix != backend {
+					continue
+				}
+				model = rest
+			}
+			out = append(out, model)
+		}
+	}
+	return out
+}
+
+// backendFor resolves a client-facing model name to a backend and the
+// model name that backend expects
+func (s *Server) backendFor(model string) (llm.Backend, string) {
+	_, b, upstream := s.llm.Route(model)
+	return b, upstream
+}
+
+func cacheDir(base, name string) string {
+	if base == "" {
+		return ""
+	}
+	return filepath.Join(base, name)
 }
 
 // Router wiring
 func (s *Server) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/v1/models", s.handleModels)
-	mux.HandleFunc("/v1/chat/completions", s.handleChatCompletions)
-	mux.HandleFunc("/v1/responses", s.handleResponses)
+	mux.HandleFunc("/v1/models/", s.handleModel)
+	mux.HandleFunc("/v1/chat/completions", s.owned(s.handleChatCompletions))
+	mux.HandleFunc("/v1/completions", s.handleCompletions)
+	mux.HandleFunc("/v1/responses", s.owned(s.handleResponses))
+	mux.HandleFunc("/v1/messages", s.owned(s.handleMessages))
 	mux.HandleFunc("/v1/images/generations", s.handleImagesGenerations)
+	mux.HandleFunc("/v1/ocr", s.owned(s.handleOCR))
+	mux.HandleFunc("/v1/audio/transcriptions", s.handleAudioTranscriptions)
+	mux.HandleFunc("/v1/audio/translations", s.handleAudioTranslations)
+	mux.HandleFunc("/v1/audio/speech", s.handleAudioSpeech)
+	mux.HandleFunc("/v1/files", s.handleFiles)
+	mux.HandleFunc("/v1/files/", s.handleFile)
+	mux.HandleFunc("/v1/batches", s.handleBatches)
+	mux.HandleFunc("/v1/batches/", s.handleBatch)
+	mux.HandleFunc("/api/", s.handleNative)
 	mux.HandleFunc("/health", s.handleHealth)
+
+	mux.HandleFunc("/admin/pull", s.admin(http.MethodPost, s.handlePull))
+	mux.HandleFunc("/admin/delete", s.admin(http.MethodPost, s.handleDeleteModel))
+	mux.HandleFunc("/admin/show", s.admin(http.MethodPost, s.handleShowModel))
+	mux.HandleFunc("/admin/ps", s.admin(http.MethodGet, s.handlePS))
+	mux.HandleFunc("/admin/load", s.admin(http.MethodPost, s.handleLoadModel))
+	mux.HandleFunc("/admin/unload", s.admin(http.MethodPost, s.handleUnloadModel))
 }
 
 // ---------- Utilities ----------
@@ -53,12 +243,6 @@ func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	_ = json.NewEncoder(w).Encode(v)
 }
 
-func writeError(w http.ResponseWriter, status int, msg string) {
-	writeJSON(w, status, map[string]interface{}{
-		"error": msg,
-	})
-}
-
 // Extract a text prompt from the last message (for SD usage)
 func promptFromMessages(msgs []ChatMessage) string {
 	if len(msgs) == 0 {
@@ -98,25 +282,50 @@ func promptFromMessages(msgs []ChatMessage) string {
 	return ""
 }
 
-func toOllamaMessages(msgs []ChatMessage, ocrClient *ocr.Client) []ollama.Message {
-	var out []ollama.Message
+// partJob produces the prompt text for an image, audio or file part. label
+// ("Image 2", "Document 1") names the part in errors.
+type partJob struct {
+	label string
+	run   func(ctx context.Context) string
+}
+
+func (s *Server) toBackendMessages(ctx context.Context, msgs []ChatMessage) []llm.Message {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.ImageDeadline)
+	defer cancel()
+
+	// First pass: collect text and queue image/file parts as jobs,
+	// remembering which message each job belongs to.
+	type pending struct {
+		role       string
+		toolCalls  []llm.ToolCall
+		toolCallID string
+		content    string
+		textParts  []string
+		docJobs    []int
+		audioJobs  []int
+		imageJobs  []int
+		multiPart  bool
+	}
+	var jobs []partJob
+	var out []pending
 
 	for _, m := range msgs {
-		role := m.Role
-		if role == "" {
-			role = "user"
+		p := pending{role: m.Role, toolCalls: toBackendToolCalls(m.ToolCalls), toolCallID: m.ToolCallID}
+		if p.role == "" {
+			p.role = "user"
 		}
 
 		switch v := m.Content.(type) {
+		case nil:
+			// assistant turns that only carry tool calls
+
 		case string:
-			out = append(out, ollama.Message{Role: role, Content: v})
+			p.content = v
 
 		case []interface{}:
-			var textParts []string
-			var ocrInserts []string
-
-			for _, p := range v {
-				part, ok := p.(map[string]interface{})
+			p.multiPart = true
+			for _, part := range v {
+				part, ok := part.(map[string]interface{})
 				if !ok {
 					continue
 				}
@@ -124,9 +333,9 @@ func toOllamaMessages(msgs []ChatMessage, ocrClient *ocr.Client) []ollama.Messag
 
 				if ptype == "text" || ptype == "input_text" {
 					if txt, ok := part["text"].(string); ok {
-						textParts = append(textParts, txt)
+						p.textParts = append(p.textParts, txt)
 					} else if txt, ok := part["content"].(string); ok {
-						textParts = append(textParts, txt)
+						p.textParts = append(p.textParts, txt)
 					}
 
 				} else if ptype == "image_url" || ptype == "input_image" || ptype == "image" {
@@ -138,73 +347,263 @@ func toOllamaMessages(msgs []ChatMessage, ocrClient *ocr.Client) []ollama.Messag
 						case map[string]interface{}:
 							if ur, ok := u["url"].(string); ok {
 								imageURL = ur
+							} else if id, ok := u["file_id"].(string); ok {
+								imageURL = id
 							}
 						}
 					} else if u, ok := part["url"].(string); ok {
 						imageURL = u
+					} else if id, ok := part["file_id"].(string); ok {
+						imageURL = id
 					}
 
 					if imageURL != "" {
-						if b64, err := maybeFetchRemoteImageToB64(imageURL); err == nil && b64 != "" {
-							ocrText := ocrClient.FromBase64Image(b64)
-							if ocrText == "" {
-								ocrText = "[OCR returned empty text]"
-							}
-							ocrInserts = append(ocrInserts, ocrText)
-						} else {
-							ocrInserts = append(ocrInserts, "[OCR could not read the image]")
-						}
+						jobs = append(jobs, s.imageJob(imageURL, len(p.imageJobs)+1))
+						p.imageJobs = append(p.imageJobs, len(jobs)-1)
 					}
-				}
-			}
 
-			merged := strings.Join(textParts, "\n")
-			if len(ocrInserts) > 0 {
-				if merged != "" {
-					merged += "\n\n"
+				} else if ptype == "input_file" || ptype == "file" {
+					src, filename := fileFromPart(part)
+					if src == "" {
+						continue
+					}
+					jobs = append(jobs, s.fileJob(src, filename, len(p.docJobs)+1))
+					p.docJobs = append(p.docJobs, len(jobs)-1)
+
+				} else if ptype == "input_audio" {
+					ia, _ := part["input_audio"].(map[string]interface{})
+					data, _ := ia["data"].(string)
+					format, _ := ia["format"].(string)
+					if data == "" {
+						continue
+					}
+					jobs = append(jobs, s.audioJob(data, format, len(p.audioJobs)+1))
+					p.audioJobs = append(p.audioJobs, len(jobs)-1)
 				}
-				merged += "[Image OCR]\n" + strings.Join(ocrInserts, "\n\n")
 			}
-			out = append(out, ollama.Message{Role: role, Content: merged})
 
 		default:
 			b, err := json.Marshal(v)
 			if err != nil {
-				out = append(out, ollama.Message{Role: role, Content: fmt.Sprint(v)})
+				p.content = fmt.Sprint(v)
 			} else {
-				out = append(out, ollama.Message{Role: role, Content: string(b)})
+				p.content = string(b)
+			}
+		}
+		out = append(out, p)
+	}
+
+	results := runJobs(ctx, jobs, s.cfg.ImageWorkers)
+
+	messages := make([]llm.Message, 0, len(out))
+	for _, p := range out {
+		if !p.multiPart {
+			messages = append(messages, llm.Message{Role: p.role, Content: p.content, ToolCalls: p.toolCalls, ToolCallID: p.toolCallID})
+			continue
+		}
+
+		merged := strings.Join(p.textParts, "\n")
+		for _, j := range p.docJobs {
+			if merged != "" {
+				merged += "\n\n"
 			}
+			merged += results[j]
+		}
+		merged = appendSection(merged, "[Audio transcript]", p.audioJobs, results)
+		merged = appendSection(merged, "[Image OCR]", p.imageJobs, results)
+		messages = append(messages, llm.Message{Role: p.role, Content: merged, ToolCalls: p.toolCalls, ToolCallID: p.toolCallID})
+	}
+	return messages
+}
+
+// toBackendToolCalls converts OpenAI tool calls, whose arguments are a JSON string
+func toBackendToolCalls(calls []ToolCall) []llm.ToolCall {
+	var out []llm.ToolCall
+	for _, c := range calls {
+		args := map[string]interface{}{}
+		if c.Function.Arguments != "" {
+			_ = json.Unmarshal([]byte(c.Function.Arguments), &args)
 		}
+		out = append(out, llm.ToolCall{ID: c.ID, Function: llm.ToolCallFunction{Name: c.Function.Name, Arguments: args}})
 	}
 	return out
 }
 
-var b64Regexp = regexp.MustCompile(`^[A-Za-z0-9+/=\r\n]+$`)
+// appendSection adds a headed block with the results of the given jobs, in order
+func appendSection(merged, header string, jobIdx []int, results []string) string {
+	if len(jobIdx) == 0 {
+		return merged
+	}
+	var inserts []string
+	for _, j := range jobIdx {
+		inserts = append(inserts, results[j])
+	}
+	if merged != "" {
+		merged += "\n\n"
+	}
+	return merged + header + "\n" + strings.Join(inserts, "\n\n")
+}
 
-func maybeFetchRemoteImageToB64(u string) (string, error) {
-	if strings.HasPrefix(u, "data:") {
-		parts := strings.SplitN(u, ",", 2)
-		if len(parts) == 2 {
-			return parts[1], nil
-		}
-		return "", fmt.Errorf("bad data url")
+// runJobs runs jobs with at most workers in flight and returns results in
+// job order. Once ctx ends, jobs not yet started are skipped and running ones
+// are no longer waited for; both get a timeout note instead. A job that
+// panics gets an error note rather than taking the process down.
+func runJobs(ctx context.Context, jobs []partJob, workers int) []string {
+	results := make([]string, len(jobs))
+	sem := make(chan struct{}, max(1, workers))
+	var wg sync.WaitGroup
+
+	for i, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// built only once ctx has ended, so the cause is set
+			timedOut := func() string {
+				return fmt.Sprintf("[%s: not processed in time: %v]", job.label, context.Cause(ctx))
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i] = timedOut()
+				return
+			}
+			// the slot stays taken until the job returns, even if it is
+			// abandoned, so no more than workers jobs ever run at once
+			done := make(chan string, 1)
+			go func() {
+				defer func() { <-sem }()
+				defer func() {
+					if r := recover(); r != nil {
+						log.Printf("%s: panic: %v\n%s", job.label, r, debug.Stack())
+						done <- fmt.Sprintf("[%s: could not be processed: internal error]", job.label)
+					}
+				}()
+				done <- job.run(ctx)
+			}()
+			select {
+			case results[i] = <-done:
+			case <-ctx.Done():
+				select {
+				case results[i] = <-done:
+				default:
+					results[i] = timedOut()
+				}
+			}
+		}()
 	}
-	if strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
-		resp, err := http.Get(u)
+	wg.Wait()
+	return results
+}
+
+func (s *Server) imageJob(imageURL string, n int) partJob {
+	return partJob{label: fmt.Sprintf("Image %d", n), run: func(ctx context.Context) string {
+		img, err := s.loadSource(ctx, imageURL, imageTypes)
+		if err != nil || len(img) == 0 {
+			return fmt.Sprintf("[Image %d: could not load the image: %v]", n, err)
+		}
+		res, err := s.recognize(ctx, img, "")
 		if err != nil {
-			return "", err
+			return fmt.Sprintf("[Image %d: %v]", n, err)
 		}
-		defer resp.Body.Close()
-		content, err := io.ReadAll(resp.Body)
+		if res.Text == "" {
+			return fmt.Sprintf("[Image %d: OCR returned empty text]", n)
+		}
+		return res.Text
+	}}
+}
+
+func (s *Server) audioJob(b64, format string, n int) partJob {
+	return partJob{label: fmt.Sprintf("Audio %d", n), run: func(ctx context.Context) string {
+		data, err := decodeB64(b64)
+		if err != nil {
+			return fmt.Sprintf("[Audio %d: %v]", n, err)
+		}
+		if format == "" {
+			format = "wav"
+		}
+		text, err := s.transcript(ctx, data, "audio."+format)
 		if err != nil {
-			return "", err
+			return fmt.Sprintf("[Audio %d: %v]", n, err)
 		}
-		return base64.StdEncoding.EncodeToString(content), nil
+		if text == "" {
+			return fmt.Sprintf("[Audio %d: no speech detected]", n)
+		}
+		return text
+	}}
+}
+
+func (s *Server) fileJob(src, filename string, n int) partJob {
+	return partJob{label: fmt.Sprintf("Document %d", n), run: func(ctx context.Context) string {
+		if filename == "" {
+			filename = s.fileName(ctx, src)
+		}
+		data, err := s.loadSource(ctx, src, documentTypes)
+		if err != nil {
+			return fmt.Sprintf("[Could not read file %s: %v]", filename, err)
+		}
+		return s.documentText(ctx, data, filename)
+	}}
+}
+
+var b64Regexp = regexp.MustCompile(`^[A-Za-z0-9+/=\r\n]+$`)
+
+// MIME prefixes accepted for image parts and for file/document inputs
+var (
+	imageTypes    = []string{"image/"}
+	documentTypes = []string{"image/", "application/pdf", "text/plain"}
+)
+
+// loadSource returns the bytes behind a data URL, http(s) URL, uploaded file
+// ID or raw base64 string, provided their sniffed type matches accept. Remote
+// fetches go through the SSRF-safe fetcher and are never cached, so a changed
+// image is seen at once; what is derived from the bytes is cached by their
+// hash instead.
+func (s *Server) loadSource(ctx context.Context, u string, accept []string) ([]byte, error) {
+	var content []byte
+	var err error
+
+	switch {
+	case strings.HasPrefix(u, "data:"):
+		parts := strings.SplitN(u, ",", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("bad data url")
+		}
+		content, err = decodeB64(parts[1])
+
+	case strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://"):
+		content, _, err = s.fetcher.Fetch(ctx, u, accept)
+
+	// checked before base64, which never contains "-"
+	case files.IsID(u):
+		content, _, err = s.readFile(ctx, u)
+
+	case b64Regexp.MatchString(strings.TrimSpace(u)):
+		content, err = decodeB64(u)
+
+	default:
+		return nil, fmt.Errorf("not URL or b64")
+	}
+	if err != nil {
+		return nil, err
 	}
-	if b64Regexp.MatchString(strings.TrimSpace(u)) {
-		return u, nil
+	if _, err := fetch.CheckType(content, accept); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+func decodeB64(v string) ([]byte, error) {
+	v = strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' || r == ' ' {
+			return -1
+		}
+		return r
+	}, v)
+	data, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %v", err)
 	}
-	return "", fmt.Errorf("not URL or b64")
+	return data, nil
 }
 
 func responsesToMessages(body map[string]interface{}) []ChatMessage {
@@ -245,18 +644,24 @@ func responsesToMessages(body map[string]interface{}) []ChatMessage {
 // ---------- Handlers ----------
 
 func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
-	modelNames, err := s.ollama.ListModels()
-	if err != nil {
-		modelNames = nil
-	}
-
 	var data []ModelInfo
-	for _, name := range modelNames {
-		data = append(data, ModelInfo{
-			ID:      name,
-			Object:  "model",
-			OwnedBy: s.cfg.ServerName,
-		})
+	for _, backend := range s.llm.Names() {
+		modelNames, err := s.llm.Backend(backend).ListModels(r.Context())
+		if err != nil {
+			continue
+		}
+		for _, name := range modelNames {
+			// models that would not route back here are listed as "backend/model"
+			id := name
+			if routed, _, _ := s.llm.Route(name); routed != backend {
+				id = backend + "/" + name
+			}
+			data = append(data, ModelInfo{
+				ID:      id,
+				Object:  "model",
+				OwnedBy: s.cfg.ServerName,
+			})
+		}
 	}
 	// add SD model
 	data = append(data, ModelInfo{
@@ -271,6 +676,58 @@ func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleModel returns one model. Ollama models carry the details,
+// capabilities and parameters from /api/show.
+func (s *Server) handleModel(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/v1/models/")
+	if id == "" {
+		s.handleModels(w, r)
+		return
+	}
+	info := map[string]interface{}{
+		"id":       id,
+		"object":   "model",
+		"owned_by": s.cfg.ServerName,
+	}
+	if id == "stable-diffusion-webui-txt2img" {
+		writeJSON(w, http.StatusOK, info)
+		return
+	}
+
+	name, backend, upstream := s.llm.Route(id)
+	info["backend"] = name
+	if client, ok := backend.(*ollama.Client); ok {
+		show, err := client.Show(r.Context(), upstream)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		for _, k := range []string{"details", "capabilities", "parameters", "modified_at"} {
+			if v, ok := show[k]; ok {
+				info[k] = v
+			}
+		}
+	} else {
+		names, err := backend.ListModels(r.Context())
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		if !slices.Contains(names, upstream) {
+			e := newAPIError(http.StatusNotFound, fmt.Sprintf("model %q not found", id))
+			e.Code = "model_not_found"
+			writeAPIError(w, e)
+			return
+		}
+	}
+	if sizer, ok := backend.(llm.ContextSizer); ok {
+		if n, err := sizer.ContextLength(r.Context(), upstream); err == nil {
+			info["context_length"] = n
+		}
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
 func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 	var reqBody ChatCompletionsRequest
 	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
@@ -282,6 +739,25 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	format, err := chatOutputFormat(reqBody.ResponseFormat)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	think, err := thinkParam(reqBody.ReasoningEffort, reqBody.Think)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	n := reqBody.N
+	if n <= 0 {
+		n = 1
+	}
+	if n > s.cfg.MaxChoices {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("n must be at most %d", s.cfg.MaxChoices))
+		return
+	}
+
 	// --- SPECIAL CASE: use Stable Diffusion when the "model" is the SD pseudo-model ---
 	if reqBody.Model == "stable-diffusion-webui-txt2img" {
 		prompt := promptFromMessages(reqBody.Messages)
@@ -293,7 +769,7 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		// You can later make size configurable; for now we just use 512x512 here.
 		b64, err := s.sd.Txt2Img(prompt, 25, 7.0, "512x512")
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+			writeUpstreamError(w, err)
 			return
 		}
 
@@ -320,9 +796,28 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// --- Normal path: send to Ollama as a chat completion ---
-	enriched := toOllamaMessages(reqBody.Messages, s.ocr)
+	// --- Normal path: send to the routed backend as a chat completion ---
+	enriched := s.toBackendMessages(r.Context(), reqBody.Messages)
 	model := reqBody.Model
+	name, backend, upstream := s.llm.Route(model)
+	admitted, release, aerr := s.acquire(w, r, name, upstream)
+	if aerr != nil {
+		writeAPIError(w, aerr)
+		return
+	}
+	defer release()
+	r = r.WithContext(admitted)
+	// extra choices (n > 1) each wait for a slot of their own
+	slot := s.admissionRequest(r, name, upstream)
+	id := fmt.Sprintf("chatcmpl_%d", time.Now().UnixMilli())
+
+	params := llm.Params{Think: think}
+	enriched, info, err := s.fitContext(r, backend, upstream, enriched, &params)
+	if err != nil {
+		writeAPIError(w, contextError(err))
+		return
+	}
+	info.writeHeaders(w)
 
 	if reqBody.Stream {
 		flusher, ok := w.(http.Flusher)
@@ -330,75 +825,146 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusInternalServerError, "streaming not supported")
 			return
 		}
+		streamParams := params
+		streamParams.Format = format.backendFormat()
+		stream, err := s.fanOutStream(r.Context(), slot, backend, enriched, upstream, streamParams, info.promptTokens, n)
+		if err != nil {
+			writeAPIError(w, requestError(r.Context(), err))
+			return
+		}
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
 
-		first := true
-		for deltaText := range s.ollama.StreamChat(enriched, model) {
-			delta := map[string]interface{}{"content": deltaText}
-			if first {
-				delta["role"] = "assistant"
-				first = false
-			}
-
+		send := func(choices []interface{}, usage map[string]interface{}) {
 			chunk := map[string]interface{}{
-				"id":      fmt.Sprintf("chatcmpl_%d", time.Now().UnixMilli()),
+				"id":      id,
 				"object":  "chat.completion.chunk",
 				"created": NowTS(),
 				"model":   model,
-				"choices": []interface{}{
-					map[string]interface{}{
-						"index":         0,
-						"delta":         delta,
-						"finish_reason": nil,
-					},
-				},
+				"choices": choices,
+			}
+			if usage != nil {
+				chunk["usage"] = usage
 			}
 			b, _ := json.Marshal(chunk)
 			fmt.Fprintf(w, "data: %s\n\n", string(b))
 			flusher.Flush()
 		}
-		done := map[string]interface{}{
-			"id":      fmt.Sprintf("chatcmpl_%d", time.Now().UnixMilli()),
-			"object":  "chat.completion.chunk",
-			"created": NowTS(),
-			"model":   model,
-			"choices": []interface{}{
+		choice := func(index int, delta map[string]interface{}, finish interface{}) []interface{} {
+			return []interface{}{
 				map[string]interface{}{
-					"index":         0,
-					"delta":         map[string]interface{}{},
-					"finish_reason": "stop",
+					"index":         index,
+					"delta":         delta,
+					"finish_reason": finish,
 				},
-			},
+			}
+		}
+
+		// deltas of the n choices are interleaved as they arrive
+		collected := make([]strings.Builder, n)
+		started := make([]bool, n)
+		failed := make([]bool, n)
+		finish := make([]string, n)
+		var promptTokens, completionTokens int
+		streamError := func(i int, e *apiError) {
+			if n > 1 {
+				e.Message = fmt.Sprintf("choice %d: %s", i, e.Message)
+			}
+			writeStreamError(w, e)
+			flusher.Flush()
+		}
+		for m := range stream {
+			i := m.index
+			if m.end {
+				if failed[i] {
+					continue
+				}
+				// a choice cut off by preemption must not look complete
+				if err := cutShort(r.Context()); err != nil && finish[i] == "" {
+					failed[i] = true
+					streamError(i, requestError(r.Context(), err))
+					continue
+				}
+				if finish[i] == "" {
+					finish[i] = "stop"
+				}
+				send(choice(i, map[string]interface{}{}, finish[i]), nil)
+				// streamed output cannot be retried; report a mismatch instead
+				if format != nil {
+					if _, err := format.check(collected[i].String()); err != nil {
+						streamError(i, formatError(err))
+					}
+				}
+				continue
+			}
+			// output has begun, so a failure can only be reported in-stream
+			if m.chunk.Err != nil {
+				failed[i] = true
+				streamError(i, requestError(r.Context(), m.chunk.Err))
+				continue
+			}
+			if m.chunk.Done {
+				finish[i] = completionFinish(m.chunk.DoneReason)
+				promptTokens = max(promptTokens, m.chunk.PromptTokens)
+				completionTokens += m.chunk.CompletionTokens
+			}
+			thinking := s.reasoning(m.chunk.Thinking)
+			if m.chunk.Content == "" && thinking == "" {
+				continue
+			}
+			collected[i].WriteString(m.chunk.Content)
+			delta := map[string]interface{}{}
+			if m.chunk.Content != "" {
+				delta["content"] = m.chunk.Content
+			}
+			if thinking != "" {
+				delta["reasoning_content"] = thinking
+			}
+			if !started[i] {
+				delta["role"] = "assistant"
+				started[i] = true
+			}
+			send(choice(i, delta, nil), nil)
+		}
+		if reqBody.StreamOptions != nil && reqBody.StreamOptions.IncludeUsage {
+			send([]interface{}{}, usageOf(promptTokens, completionTokens))
 		}
-		b, _ := json.Marshal(done)
-		fmt.Fprintf(w, "data: %s\n\n", string(b))
 		fmt.Fprint(w, "data: [DONE]\n\n")
 		flusher.Flush()
 		return
 	}
 
-	ans, err := s.ollama.CallChat(enriched, model)
+	answers, err := s.chatChoices(r.Context(), slot, backend, enriched, upstream, params, format, n)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeAPIError(w, requestError(r.Context(), err))
 		return
 	}
+	var choices []interface{}
+	var promptTokens, completionTokens int
+	for i, ans := range answers {
+		message := map[string]interface{}{
+			"role":    "assistant",
+			"content": ans.Content,
+		}
+		if thinking := s.reasoning(ans.Thinking); thinking != "" {
+			message["reasoning_content"] = thinking
+		}
+		choices = append(choices, map[string]interface{}{
+			"index":         i,
+			"message":       message,
+			"finish_reason": completionFinish(ans.DoneReason),
+		})
+		promptTokens = max(promptTokens, ans.PromptTokens)
+		completionTokens += ans.CompletionTokens
+	}
 	resp := map[string]interface{}{
-		"id":      fmt.Sprintf("chatcmpl_%d", time.Now().UnixMilli()),
+		"id":      id,
 		"object":  "chat.completion",
 		"created": NowTS(),
 		"model":   model,
-		"choices": []interface{}{
-			map[string]interface{}{
-				"index": 0,
-				"message": map[string]interface{}{
-					"role":    "assistant",
-					"content": ans,
-				},
-				"finish_reason": "stop",
-			},
-		},
+		"choices": choices,
+		"usage":   usageOf(promptTokens, completionTokens),
 	}
 	writeJSON(w, http.StatusOK, resp)
 }
@@ -416,9 +982,35 @@ func (s *Server) handleResponses(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	stream, _ := body["stream"].(bool)
+	format, err := responsesOutputFormat(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	think, err := responsesThink(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	baseMsgs := responsesToMessages(body)
-	enriched := toOllamaMessages(baseMsgs, s.ocr)
+	enriched := s.toBackendMessages(r.Context(), baseMsgs)
+	backend, upstream := s.backendFor(model)
+	admitted, release, aerr := s.admit(w, r, model)
+	if aerr != nil {
+		writeAPIError(w, aerr)
+		return
+	}
+	defer release()
+	r = r.WithContext(admitted)
+	params := llm.Params{Think: think}
+	enriched, info, err := s.fitContext(r, backend, upstream, enriched, &params)
+	if err != nil {
+		writeAPIError(w, contextError(err))
+		return
+	}
+	info.writeHeaders(w)
 
 	if stream {
 		flusher, ok := w.(http.Flusher)
@@ -426,13 +1018,32 @@ func (s *Server) handleResponses(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusInternalServerError, "streaming not supported")
 			return
 		}
+		streamParams := params
+		streamParams.Format = format.backendFormat()
+		chunks, err := s.openStream(r.Context(), backend, enriched, upstream, streamParams, info.promptTokens)
+		if err != nil {
+			writeAPIError(w, requestError(r.Context(), err))
+			return
+		}
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
 
 		var collected []string
-		for deltaText := range s.ollama.StreamChat(enriched, model) {
-			collected = append(collected, deltaText)
+		var thinking strings.Builder
+		failed, done := false, false
+		for chunk := range chunks {
+			if chunk.Err != nil {
+				writeStreamError(w, requestError(r.Context(), chunk.Err))
+				failed = true
+				break
+			}
+			done = done || chunk.Done
+			thinking.WriteString(s.reasoning(chunk.Thinking))
+			if chunk.Content == "" && s.reasoning(chunk.Thinking) == "" {
+				continue
+			}
+			collected = append(collected, chunk.Content)
 			answer := strings.Join(collected, "")
 
 			out := map[string]interface{}{
@@ -440,32 +1051,30 @@ func (s *Server) handleResponses(w http.ResponseWriter, r *http.Request) {
 				"object":  "response",
 				"created": NowTS(),
 				"model":   model,
-				"output": []interface{}{
-					map[string]interface{}{
-						"type": "message",
-						"role": "assistant",
-						"content": []interface{}{
-							map[string]interface{}{
-								"type": "text",
-								"text": answer,
-							},
-						},
-					},
-				},
-				"usage": nil,
+				"output":  responsesOutput(thinking.String(), answer),
+				"usage":   nil,
 			}
 			b, _ := json.Marshal(out)
 			fmt.Fprintf(w, "data: %s\n\n", string(b))
 			flusher.Flush()
 		}
+		if err := cutShort(r.Context()); err != nil && !failed && !done {
+			writeStreamError(w, requestError(r.Context(), err))
+			failed = true
+		}
+		if format != nil && !failed {
+			if _, err := format.check(strings.Join(collected, "")); err != nil {
+				writeStreamError(w, formatError(err))
+			}
+		}
 		fmt.Fprint(w, "data: [DONE]\n\n")
 		flusher.Flush()
 		return
 	}
 
-	ans, err := s.ollama.CallChat(enriched, model)
+	ans, err := s.callStructured(r.Context(), backend, enriched, upstream, params, format)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeAPIError(w, requestError(r.Context(), err))
 		return
 	}
 	resp := map[string]interface{}{
@@ -473,21 +1082,28 @@ func (s *Server) handleResponses(w http.ResponseWriter, r *http.Request) {
 		"object":  "response",
 		"created": NowTS(),
 		"model":   model,
-		"output": []interface{}{
+		"output":  responsesOutput(s.reasoning(ans.Thinking), ans.Content),
+		"usage":   nil,
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// responsesOutput builds the output items: reasoning (if any), then the message
+func responsesOutput(thinking, answer string) []interface{} {
+	var out []interface{}
+	if thinking != "" {
+		out = append(out, reasoningItem(thinking))
+	}
+	return append(out, map[string]interface{}{
+		"type": "message",
+		"role": "assistant",
+		"content": []interface{}{
 			map[string]interface{}{
-				"type": "message",
-				"role": "assistant",
-				"content": []interface{}{
-					map[string]interface{}{
-						"type": "text",
-						"text": ans,
-					},
-				},
+				"type": "text",
+				"text": answer,
 			},
 		},
-		"usage": nil,
-	}
-	writeJSON(w, http.StatusOK, resp)
+	})
 }
 
 func (s *Server) handleImagesGenerations(w http.ResponseWriter, r *http.Request) {
@@ -501,7 +1117,7 @@ func (s *Server) handleImagesGenerations(w http.ResponseWriter, r *http.Request)
 	}
 	b64, err := s.sd.Txt2Img(reqBody.Prompt, 25, 7.0, reqBody.Size)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeUpstreamError(w, err)
 		return
 	}
 	resp := map[string]interface{}{
@@ -520,10 +1136,16 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		"server": "ok",
 	}
 
-	if v, err := s.ollama.HealthCheck(); err == nil {
-		status["ollama"] = v
-	} else {
-		status["ollama"] = fmt.Sprintf("error:%v", err)
+	for _, name := range s.llm.Names() {
+		key := name
+		if name != s.llm.Default() {
+			key = "llm:" + name
+		}
+		if v, err := s.llm.Backend(name).HealthCheck(); err == nil {
+			status[key] = v
+		} else {
+			status[key] = fmt.Sprintf("error:%v", err)
+		}
 	}
 	if v, err := s.sd.HealthCheck(); err == nil {
 		status["sd_webui"] = v
@@ -535,6 +1157,25 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	} else {
 		status["ocr"] = v // unknown or error already encoded
 	}
+	if v, err := s.audio.HealthCheck(); err == nil {
+		status["whisper"] = v
+	} else {
+		status["whisper"] = fmt.Sprintf("error:%v", err)
+	}
+	if v, err := s.tts.HealthCheck(); err == nil {
+		status["tts"] = v
+	} else {
+		status["tts"] = fmt.Sprintf("error:%v", err)
+	}
+	status["cache"] = map[string]interface{}{
+		"ocr":       s.ocrCache.Stats(),
+		"audio":     s.audioCache.Stats(),
+		"summaries": s.summaryCache.Stats(),
+	}
+	status["admission"] = s.admission.Stats()
+	if models := s.warm.status(); len(models) > 0 {
+		status["models"] = models
+	}
 
 	writeJSON(w, http.StatusOK, status)
 }
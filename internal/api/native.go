@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/calvarado2004/LlamaMux/internal/ollama"
+)
+
+// nativeRoutes are the Ollama API paths exposed as-is under /api/.
+// Model management (pull, push, create, delete, copy) is left out; the /admin
+// endpoints cover it behind LLAMAMUX_ADMIN_KEY.
+var nativeRoutes = map[string]string{
+	"/api/chat":       http.MethodPost,
+	"/api/generate":   http.MethodPost,
+	"/api/embed":      http.MethodPost,
+	"/api/embeddings": http.MethodPost,
+	"/api/show":       http.MethodPost,
+	"/api/tags":       http.MethodGet,
+	"/api/ps":         http.MethodGet,
+	"/api/version":    http.MethodGet,
+}
+
+// nativeQueued are the routes that run a model and so pass the admission
+// controller, like the OpenAI-style endpoints
+var nativeQueued = map[string]bool{
+	"/api/chat":       true,
+	"/api/generate":   true,
+	"/api/embed":      true,
+	"/api/embeddings": true,
+}
+
+// nativeRouted are the routes that name a model in their body. They go to
+// the Ollama backend the model routes to ("gpu2/llama3:8b", MODEL_ROUTES),
+// with the model renamed to what that backend calls it; the rest go to the
+// default Ollama.
+var nativeRouted = map[string]bool{
+	"/api/chat":       true,
+	"/api/generate":   true,
+	"/api/embed":      true,
+	"/api/embeddings": true,
+	"/api/show":       true,
+}
+
+// handleNative proxies Ollama-native requests so clients such as Open WebUI
+// or the ollama CLI can use the gateway. Streaming NDJSON is relayed line by
+// line as it arrives.
+func (s *Server) handleNative(w http.ResponseWriter, r *http.Request) {
+	method, ok := nativeRoutes[r.URL.Path]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unsupported Ollama API path: " + r.URL.Path})
+		return
+	}
+	// Ollama accepts HEAD on GET routes; the CLI uses it for liveness checks
+	if r.Method != method && !(method == http.MethodGet && r.Method == http.MethodHead) {
+		w.Header().Set("Allow", method)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var body io.Reader = r.Body
+	client := s.ollama
+	if nativeRouted[r.URL.Path] {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "reading body: " + err.Error()})
+			return
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(b, &fields); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+			return
+		}
+		// /api/show also accepts the older "name"
+		key := "model"
+		if _, ok := fields[key]; !ok && r.URL.Path == "/api/show" {
+			key = "name"
+		}
+		var model string
+		json.Unmarshal(fields[key], &model)
+
+		name, backend, upstream := s.llm.Route(model)
+		c, ok := backend.(*ollama.Client)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("model %q is served by backend %s, which is not Ollama", model, name)})
+			return
+		}
+		client = c
+		if model != "" {
+			fields[key], _ = json.Marshal(upstream)
+			b, _ = json.Marshal(fields)
+		}
+
+		if nativeQueued[r.URL.Path] {
+			admitted, release, aerr := s.acquire(w, r, name, upstream)
+			if aerr != nil {
+				writeJSON(w, aerr.status, map[string]string{"error": aerr.Message})
+				return
+			}
+			defer release()
+			r = r.WithContext(admitted)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	resp, err := client.Proxy(r.Context(), r.Method, r.URL.RequestURI(), body, r.Header.Get("Content-Type"))
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "ollama: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, h := range []string{"Content-Type", "Content-Length"} {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	if flusher == nil || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/x-ndjson") {
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
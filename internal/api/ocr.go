@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/calvarado2004/LlamaMux/internal/cache"
+	"github.com/calvarado2004/LlamaMux/internal/document"
+	"github.com/calvarado2004/LlamaMux/internal/fetch"
+	"github.com/calvarado2004/LlamaMux/internal/ocr"
+)
+
+const maxOCRUploadBytes = 32 << 20
+
+// readOCRInput returns the raw bytes and filename for a /v1/ocr request,
+// accepting multipart uploads as well as JSON with a URL, data URL or base64 payload.
+func (s *Server) readOCRInput(w http.ResponseWriter, r *http.Request) ([]byte, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOCRUploadBytes)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxOCRUploadBytes); err != nil {
+			return nil, "", fmt.Errorf("invalid multipart body: %v", err)
+		}
+		if f, hdr, err := r.FormFile("file"); err == nil {
+			defer f.Close()
+			data, err := io.ReadAll(f)
+			if err != nil {
+				return nil, "", err
+			}
+			// uploads get the same type check as fetched and inline sources
+			if _, err := fetch.CheckType(data, documentTypes); err != nil {
+				return nil, "", err
+			}
+			return data, hdr.Filename, nil
+		}
+		if u := r.FormValue("url"); u != "" {
+			data, err := s.loadSource(r.Context(), u, documentTypes)
+			return data, r.FormValue("filename"), err
+		}
+		return nil, "", fmt.Errorf("multipart body needs a \"file\" or \"url\" field")
+	}
+
+	var req OCRRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, "", fmt.Errorf("invalid JSON")
+	}
+	src := req.URL
+	switch u := req.ImageURL.(type) {
+	case string:
+		src = u
+	case map[string]interface{}:
+		if ur, ok := u["url"].(string); ok {
+			src = ur
+		}
+	}
+	if req.Image != "" {
+		src = req.Image
+	}
+	if req.File != "" {
+		src = req.File
+	}
+	if src == "" {
+		return nil, "", fmt.Errorf("one of file, image, image_url or url is required")
+	}
+	data, err := s.loadSource(r.Context(), src, documentTypes)
+	return data, req.Filename, err
+}
+
+// recognize runs OCR through the content-hash cache
+func (s *Server) recognize(ctx context.Context, data []byte, filename string) (*ocr.Result, error) {
+	key := cache.Key(data)
+	if b, ok := s.ocrCache.Get(key); ok {
+		var res ocr.Result
+		if err := json.Unmarshal(b, &res); err == nil {
+			return &res, nil
+		}
+	}
+	res, err := s.ocr.FromBytes(ctx, data, filename)
+	if err != nil {
+		return nil, err
+	}
+	if b, err := json.Marshal(res); err == nil {
+		s.ocrCache.Put(key, b)
+	}
+	return res, nil
+}
+
+func (s *Server) handleOCR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST for /v1/ocr")
+		return
+	}
+	data, filename, err := s.readOCRInput(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(data) == 0 {
+		writeError(w, http.StatusBadRequest, "empty input")
+		return
+	}
+
+	if document.Detect(data) != "" {
+		s.writeDocumentOCR(w, r, data)
+		return
+	}
+
+	res, err := s.recognize(r.Context(), data, filename)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"object":   "ocr.result",
+		"created":  NowTS(),
+		"text":     res.Text,
+		"language": res.Language,
+		"blocks":   res.Blocks,
+	})
+}
+
+// writeDocumentOCR answers /v1/ocr for PDFs and multi-page TIFFs, page by page
+func (s *Server) writeDocumentOCR(w http.ResponseWriter, r *http.Request, data []byte) {
+	doc, err := document.Split(data, s.docLimits())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var texts []string
+	var pages []interface{}
+	for _, p := range s.readPages(r.Context(), doc.Pages) {
+		page := map[string]interface{}{
+			"page":   p.Number,
+			"source": p.Source,
+			"text":   p.Text,
+		}
+		if p.OCR != nil {
+			page["language"] = p.OCR.Language
+			page["blocks"] = p.OCR.Blocks
+		}
+		if p.Err != nil {
+			page["error"] = p.Err.Error()
+		}
+		pages = append(pages, page)
+		texts = append(texts, p.Text)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"object":      "ocr.result",
+		"created":     NowTS(),
+		"text":        strings.Join(texts, "\n\n"),
+		"pages":       pages,
+		"total_pages": doc.TotalPages,
+		"truncated":   doc.Truncated(),
+	})
+}
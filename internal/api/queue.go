@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/calvarado2004/LlamaMux/internal/admission"
+)
+
+// LLM requests pass the admission controller before reaching a backend, so
+// a model that can run four requests at a time gets at most four and the
+// rest wait in a queue shared fairly between API keys.
+//
+// A request is interactive or batch: KEY_PRIORITIES gives the class per API
+// key, DEFAULT_PRIORITY the rest. "X-Priority: batch" lowers a request's
+// class; a header cannot raise it.
+
+// apiKey is the caller's bearer token or x-api-key, if any
+func apiKey(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+		return token
+	}
+	return r.Header.Get("X-Api-Key")
+}
+
+// clientKey identifies the caller for fair queueing: the API key, or the
+// remote address when there is none
+func clientKey(r *http.Request) string {
+	if key := apiKey(r); key != "" {
+		return "key:" + key
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+func (s *Server) requestClass(r *http.Request) admission.Class {
+	name := s.cfg.DefaultPriority
+	if p, ok := s.cfg.KeyPriorities[apiKey(r)]; ok {
+		name = p
+	}
+	class, _ := admission.ParseClass(name)
+	// Batch > Interactive, so the header can only lower the class
+	if h, ok := admission.ParseClass(strings.ToLower(r.Header.Get("X-Priority"))); ok && h > class {
+		class = h
+	}
+	return class
+}
+
+// admit waits for a slot for model, routed like the request itself. It
+// returns the context to run the request under, which ends early if a batch
+// request is preempted, and the function that frees the slot.
+func (s *Server) admit(w http.ResponseWriter, r *http.Request, model string) (context.Context, func(), *apiError) {
+	name, _, upstream := s.llm.Route(model)
+	return s.acquire(w, r, name, upstream)
+}
+
+func (s *Server) acquire(w http.ResponseWriter, r *http.Request, backend, model string) (context.Context, func(), *apiError) {
+	ctx, release, err := s.admission.Acquire(r.Context(), s.admissionRequest(r, backend, model))
+	if err != nil {
+		e := admissionError(err)
+		if e.status == http.StatusTooManyRequests || e.status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "1")
+		}
+		return nil, nil, e
+	}
+	return ctx, release, nil
+}
+
+// admissionRequest describes a call made on behalf of r
+func (s *Server) admissionRequest(r *http.Request, backend, model string) admission.Request {
+	return admission.Request{
+		Key:     clientKey(r),
+		Backend: backend,
+		Model:   model,
+		Class:   s.requestClass(r),
+	}
+}
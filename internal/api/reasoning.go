@@ -0,0 +1,48 @@
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+// thinkParam turns reasoning_effort / think into llm.Params.Think. The
+// effort level is passed through as a string; each backend maps it to what
+// it understands.
+func thinkParam(effort string, think *bool) (interface{}, error) {
+	if think != nil {
+		return *think, nil
+	}
+	switch effort {
+	case "":
+		return nil, nil
+	case "none", "minimal", "low", "medium", "high":
+		return effort, nil
+	}
+	return nil, fmt.Errorf("unsupported reasoning_effort %q", effort)
+}
+
+// responsesThink reads reasoning.effort from a /v1/responses body
+func responsesThink(body map[string]interface{}) (interface{}, error) {
+	reasoning, _ := body["reasoning"].(map[string]interface{})
+	effort, _ := reasoning["effort"].(string)
+	return thinkParam(effort, nil)
+}
+
+// reasoning returns thinking unless HIDE_REASONING is set
+func (s *Server) reasoning(thinking string) string {
+	if s.cfg.HideReasoning {
+		return ""
+	}
+	return thinking
+}
+
+// reasoningItem is the Responses API output item carrying the model's thinking
+func reasoningItem(thinking string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "reasoning",
+		"id":   fmt.Sprintf("rs_%d", time.Now().UnixMilli()),
+		"summary": []interface{}{
+			map[string]interface{}{"type": "summary_text", "text": thinking},
+		},
+	}
+}
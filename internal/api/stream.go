@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/calvarado2004/LlamaMux/internal/llm"
+)
+
+// Streams are held back until their first chunk. A failure before that
+// (model load, out of memory, backend down) is retried transparently: first
+// with a smaller num_ctx, then on each LLM_FALLBACKS backend with the same
+// model name. Once output has begun a failure can only be reported as an
+// error event in the stream.
+
+// streamMinAnswer is the answer room a smaller-context retry must leave
+const streamMinAnswer = 256
+
+// streamAttempt is one way of running the stream
+type streamAttempt struct {
+	backend  llm.Backend
+	name     string
+	upstream string
+	p        llm.Params
+}
+
+func (s *Server) streamAttempts(backend llm.Backend, upstream string, p llm.Params, promptTokens int) []streamAttempt {
+	attempts := []streamAttempt{{backend: backend, upstream: upstream, p: p}}
+	for n := p.NumCtx / 2; n >= promptTokens+streamMinAnswer && len(attempts) < 3; n /= 2 {
+		smaller := p
+		smaller.NumCtx = n
+		attempts = append(attempts, streamAttempt{backend: backend, upstream: upstream, p: smaller})
+	}
+	for _, name := range s.cfg.LLMFallbacks {
+		if b := s.llm.Backend(name); b != nil && b != backend {
+			attempts = append(attempts, streamAttempt{backend: b, name: name, upstream: upstream, p: p})
+		}
+	}
+	return attempts
+}
+
+// openStream starts a chat stream and returns it once the first chunk has
+// arrived. The error is the last failure when every attempt failed before
+// producing output.
+func (s *Server) openStream(ctx context.Context, backend llm.Backend, msgs []llm.Message, upstream string, p llm.Params, promptTokens int) (<-chan llm.StreamChunk, error) {
+	var lastErr error
+	for i, a := range s.streamAttempts(backend, upstream, p, promptTokens) {
+		if i > 0 {
+			if a.name != "" {
+				log.Printf("stream %s: %v; retrying on backend %s", upstream, lastErr, a.name)
+			} else {
+				log.Printf("stream %s: %v; retrying with num_ctx %d", upstream, lastErr, a.p.NumCtx)
+			}
+		}
+		ch := a.backend.StreamChat(ctx, msgs, a.upstream, a.p)
+		first, ok := <-ch
+		if !ok {
+			lastErr = errors.New("stream ended without output")
+		} else if first.Err != nil {
+			lastErr = first.Err
+		} else {
+			return prepend(ctx, first, ch), nil
+		}
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		for range ch {
+		}
+	}
+	return nil, lastErr
+}
+
+// prepend returns a channel yielding first and then the rest of ch
+func prepend(ctx context.Context, first llm.StreamChunk, ch <-chan llm.StreamChunk) <-chan llm.StreamChunk {
+	out := make(chan llm.StreamChunk)
+	go func() {
+		defer close(out)
+		for c, ok := first, true; ok; c, ok = <-ch {
+			select {
+			case out <- c:
+			case <-ctx.Done():
+				for range ch {
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
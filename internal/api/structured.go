@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/calvarado2004/LlamaMux/internal/jsonschema"
+	"github.com/calvarado2004/LlamaMux/internal/llm"
+)
+
+// outputFormat is a parsed response_format / text.format. format goes to the
+// backend (Ollama's "format": "json" or a schema); schema, when set, is
+// checked server-side.
+type outputFormat struct {
+	format interface{}
+	schema interface{}
+}
+
+func newOutputFormat(kind string, schema interface{}) (*outputFormat, error) {
+	switch kind {
+	case "", "text":
+		return nil, nil
+	case "json_object":
+		return &outputFormat{format: "json"}, nil
+	case "json_schema":
+		if schema == nil {
+			return nil, fmt.Errorf("response_format json_schema requires a schema")
+		}
+		if _, ok := schema.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("response_format schema must be an object")
+		}
+		if err := jsonschema.Check(schema); err != nil {
+			return nil, fmt.Errorf("response_format schema: %w", err)
+		}
+		return &outputFormat{format: schema, schema: schema}, nil
+	}
+	return nil, fmt.Errorf("unsupported response_format type %q", kind)
+}
+
+// chatOutputFormat reads response_format from /v1/chat/completions
+func chatOutputFormat(rf *ResponseFormat) (*outputFormat, error) {
+	if rf == nil {
+		return nil, nil
+	}
+	var schema interface{}
+	if rf.JSONSchema != nil {
+		schema = rf.JSONSchema.Schema
+	}
+	return newOutputFormat(rf.Type, schema)
+}
+
+// responsesOutputFormat reads text.format from /v1/responses, where the
+// schema sits directly on the format object
+func responsesOutputFormat(body map[string]interface{}) (*outputFormat, error) {
+	text, _ := body["text"].(map[string]interface{})
+	f, _ := text["format"].(map[string]interface{})
+	if f == nil {
+		return nil, nil
+	}
+	kind, _ := f["type"].(string)
+	return newOutputFormat(kind, f["schema"])
+}
+
+func (f *outputFormat) backendFormat() interface{} {
+	if f == nil {
+		return nil
+	}
+	return f.format
+}
+
+// stripFences removes a ```json ... ``` wrapper some models add
+func stripFences(s string) string {
+	t := strings.TrimSpace(s)
+	if !strings.HasPrefix(t, "```") {
+		return s
+	}
+	t = strings.TrimPrefix(t, "```")
+	if nl := strings.IndexByte(t, '\n'); nl >= 0 {
+		t = t[nl+1:]
+	}
+	t = strings.TrimSuffix(strings.TrimSpace(t), "```")
+	return strings.TrimSpace(t)
+}
+
+// check returns the cleaned JSON text, or why it does not satisfy the format
+func (f *outputFormat) check(content string) (string, error) {
+	cleaned := stripFences(content)
+	if f.schema == nil {
+		if !json.Valid([]byte(cleaned)) {
+			return content, fmt.Errorf("output is not valid JSON")
+		}
+		return cleaned, nil
+	}
+	if err := jsonschema.ValidateJSON(f.schema, []byte(cleaned)); err != nil {
+		return content, err
+	}
+	return cleaned, nil
+}
+
+// callStructured runs a chat call and validates the answer against f. On a
+// mismatch the model is shown its reply and the validation error and asked
+// again, up to STRUCTURED_OUTPUT_RETRIES more times.
+func (s *Server) callStructured(ctx context.Context, backend llm.Backend, msgs []llm.Message, model string, p llm.Params, f *outputFormat) (*llm.ChatResponse, error) {
+	if f == nil {
+		return backend.CallChat(ctx, msgs, model, p)
+	}
+	p.Format = f.format
+
+	var promptTokens, completionTokens int
+	var lastErr error
+	for attempt := 0; attempt <= s.cfg.StructuredRetries; attempt++ {
+		ans, err := backend.CallChat(ctx, msgs, model, p)
+		if err != nil {
+			return nil, err
+		}
+		promptTokens += ans.PromptTokens
+		completionTokens += ans.CompletionTokens
+
+		// tool calls are not subject to the output format
+		if len(ans.ToolCalls) > 0 {
+			return ans, nil
+		}
+		cleaned, err := f.check(ans.Content)
+		if err == nil {
+			ans.Content = cleaned
+			ans.PromptTokens, ans.CompletionTokens = promptTokens, completionTokens
+			return ans, nil
+		}
+		lastErr = err
+
+		msgs = append(msgs,
+			llm.Message{Role: "assistant", Content: ans.Content},
+			llm.Message{Role: "user", Content: fmt.Sprintf(
+				"Your reply does not satisfy the required JSON format (%v). Reply again with only the corrected JSON.", err)},
+		)
+	}
+	return nil, fmt.Errorf("model output did not match response_format after %d attempts: %v", s.cfg.StructuredRetries+1, lastErr)
+}
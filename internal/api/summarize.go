@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/calvarado2004/LlamaMux/internal/admission"
+	"github.com/calvarado2004/LlamaMux/internal/cache"
+	"github.com/calvarado2004/LlamaMux/internal/llm"
+)
+
+// Summaries for CONTEXT_STRATEGY=summarize. The dropped turns are folded in
+// chunks of about SUMMARY_CHUNK_TOKENS, each step summarizing the previous
+// summary plus the next chunk. Chunk boundaries are counted from the start
+// of the conversation, so as it grows only the tail is summarized again;
+// every step is cached under a hash of the model and the prefix it covers.
+
+const summaryPrompt = "Summarize the conversation below for the assistant that will continue it. " +
+	"Keep facts, decisions, names, numbers, open questions and anything the user asked to remember. " +
+	"Reply with the summary only."
+
+// summarize returns a system message standing in for dropped. SUMMARY_MODEL
+// is used when set, otherwise the conversation's own model. The request's
+// slot covers its own model; SUMMARY_MODEL is admitted like any other call,
+// once the cache misses.
+func (s *Server) summarize(r *http.Request, backend llm.Backend, model string, dropped []llm.Message) (llm.Message, error) {
+	ctx := r.Context()
+	name := model
+	var admit *admission.Request
+	if s.cfg.SummaryModel != "" {
+		bname, b, upstream := s.llm.Route(s.cfg.SummaryModel)
+		if b != backend || upstream != model {
+			req := s.admissionRequest(r, bname, upstream)
+			admit = &req
+		}
+		backend, model = b, upstream
+		name = s.cfg.SummaryModel
+	}
+
+	var summary string
+	for _, end := range summaryChunks(dropped, s.cfg.SummaryChunkTokens) {
+		key := summaryKey(name, dropped[:end])
+		if cached, ok := s.summaryCache.Get(key); ok {
+			summary = string(cached)
+			continue
+		}
+		start := 0
+		if summary != "" {
+			start = lastChunkStart(dropped, end, s.cfg.SummaryChunkTokens)
+		}
+		if admit != nil {
+			admitted, release, err := s.admission.Acquire(ctx, *admit)
+			if err != nil {
+				return llm.Message{}, fmt.Errorf("%s: %w", s.cfg.SummaryModel, err)
+			}
+			defer release()
+			ctx, admit = admitted, nil
+		}
+		var err error
+		summary, err = s.summarizeStep(ctx, backend, model, summary, dropped[start:end])
+		if err != nil {
+			return llm.Message{}, err
+		}
+		s.summaryCache.Put(key, []byte(summary))
+	}
+	return llm.Message{Role: "system", Content: "Summary of the earlier conversation:\n" + summary}, nil
+}
+
+func (s *Server) summarizeStep(ctx context.Context, backend llm.Backend, model, previous string, msgs []llm.Message) (string, error) {
+	var b strings.Builder
+	if previous != "" {
+		b.WriteString("Summary so far:\n")
+		b.WriteString(previous)
+		b.WriteString("\n\nContinuation:\n")
+	}
+	for _, m := range msgs {
+		content := m.Content
+		for _, tc := range m.ToolCalls {
+			args, _ := json.Marshal(tc.Function.Arguments)
+			content += fmt.Sprintf("\n[called %s(%s)]", tc.Function.Name, args)
+		}
+		fmt.Fprintf(&b, "%s: %s\n", m.Role, strings.TrimSpace(content))
+	}
+
+	ans, err := backend.CallChat(ctx, []llm.Message{
+		{Role: "system", Content: summaryPrompt},
+		{Role: "user", Content: b.String()},
+	}, model, llm.Params{MaxTokens: s.cfg.SummaryMaxTokens})
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(ans.Content)
+	if text == "" {
+		return "", fmt.Errorf("summary model returned no text")
+	}
+	return text, nil
+}
+
+// summaryChunks returns the end index of every chunk, greedily packing
+// messages up to chunkTokens (a chunk holds at least one message)
+func summaryChunks(msgs []llm.Message, chunkTokens int) []int {
+	var ends []int
+	size := 0
+	for i := range msgs {
+		cost := llm.EstimateMessages(msgs[i : i+1])
+		if size > 0 && chunkTokens > 0 && size+cost > chunkTokens {
+			ends = append(ends, i)
+			size = 0
+		}
+		size += cost
+	}
+	if len(msgs) > 0 {
+		ends = append(ends, len(msgs))
+	}
+	return ends
+}
+
+// lastChunkStart is where the chunk ending at end begins
+func lastChunkStart(msgs []llm.Message, end, chunkTokens int) int {
+	start := 0
+	for _, e := range summaryChunks(msgs[:end], chunkTokens) {
+		if e < end {
+			start = e
+		}
+	}
+	return start
+}
+
+func summaryKey(model string, msgs []llm.Message) string {
+	b, _ := json.Marshal(struct {
+		Model    string        `json:"model"`
+		Messages []llm.Message `json:"messages"`
+	}{model, msgs})
+	return cache.Key(b)
+}
@@ -5,14 +5,64 @@ import "time"
 // OpenAI-ish schemas
 
 type ChatMessage struct {
-	Role    string      `json:"role"`
-	Content interface{} `json:"content"`
+	Role       string      `json:"role"`
+	Content    interface{} `json:"content"`
+	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"`
+}
+
+type ToolCall struct {
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
 type ChatCompletionsRequest struct {
-	Model    string        `json:"model"`
-	Messages []ChatMessage `json:"messages"`
-	Stream   bool          `json:"stream"`
+	Model          string          `json:"model"`
+	Messages       []ChatMessage   `json:"messages"`
+	Stream         bool            `json:"stream"`
+	ResponseFormat *ResponseFormat `json:"response_format"`
+	N              int             `json:"n"`
+	StreamOptions  *StreamOptions  `json:"stream_options"`
+	// ReasoningEffort is "none", "minimal", "low", "medium" or "high";
+	// Think is the Ollama-style on/off switch and wins when both are set
+	ReasoningEffort string `json:"reasoning_effort"`
+	Think           *bool  `json:"think"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ResponseFormat is "text", "json_object" or "json_schema"
+type ResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema"`
+}
+
+type JSONSchemaFormat struct {
+	Name   string      `json:"name"`
+	Schema interface{} `json:"schema"`
+	Strict *bool       `json:"strict"`
+}
+
+// CompletionsRequest is the legacy text completions API; Prompt is a string
+// or an array of strings and Stop a string or an array of strings.
+type CompletionsRequest struct {
+	Model       string      `json:"model"`
+	Prompt      interface{} `json:"prompt"`
+	Suffix      string      `json:"suffix"`
+	Echo        bool        `json:"echo"`
+	Stop        interface{} `json:"stop"`
+	MaxTokens   int         `json:"max_tokens"`
+	Temperature *float64    `json:"temperature"`
+	TopP        *float64    `json:"top_p"`
+	Stream      bool        `json:"stream"`
 }
 
 type ImagesGenerationsRequest struct {
@@ -21,6 +71,49 @@ type ImagesGenerationsRequest struct {
 	Size   string `json:"size"`
 }
 
+// OCRRequest is the JSON form of /v1/ocr; multipart uploads use the "file" field instead
+type OCRRequest struct {
+	File     string      `json:"file"`
+	Image    string      `json:"image"`
+	ImageURL interface{} `json:"image_url"`
+	URL      string      `json:"url"`
+	Filename string      `json:"filename"`
+}
+
+type SpeechRequest struct {
+	Model          string   `json:"model"`
+	Input          string   `json:"input"`
+	Voice          string   `json:"voice"`
+	Speed          *float64 `json:"speed"`
+	ResponseFormat string   `json:"response_format"`
+}
+
+// Anthropic Messages API schemas
+
+type AnthropicMessagesRequest struct {
+	Model         string             `json:"model"`
+	System        interface{}        `json:"system"`
+	Messages      []AnthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	StopSequences []string           `json:"stop_sequences"`
+	Stream        bool               `json:"stream"`
+	Temperature   *float64           `json:"temperature"`
+	TopP          *float64           `json:"top_p"`
+	TopK          *int               `json:"top_k"`
+	Tools         []AnthropicTool    `json:"tools"`
+}
+
+type AnthropicMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+type AnthropicTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema interface{} `json:"input_schema"`
+}
+
 // Model list
 
 type ModelInfo struct {
@@ -34,4 +127,3 @@ type ModelInfo struct {
 func NowTS() int64 {
 	return time.Now().Unix()
 }
-
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/calvarado2004/LlamaMux/internal/ollama"
+)
+
+// Loading weights makes the first request after idle slow. WARMUP_MODELS are
+// loaded once in the background at startup; HOT_MODELS are loaded with no
+// expiry and checked every HOT_MODELS_INTERVAL, so a model Ollama evicted
+// (memory pressure, restart) is brought back before a client needs it.
+// Models are routed like requests: "gpu2/llama3:8b" stays on gpu2.
+
+// warmModel is the state of one configured model, as shown in /health
+type warmModel struct {
+	Model   string `json:"model"`
+	Backend string `json:"backend"`
+	Hot     bool   `json:"hot"`
+	// State is pending, loading, loaded, unloaded or failed
+	State    string `json:"state"`
+	LoadedAt string `json:"loaded_at,omitempty"`
+	Loads    int    `json:"loads"`
+	Error    string `json:"error,omitempty"`
+
+	client   *ollama.Client
+	upstream string
+}
+
+type warmer struct {
+	interval time.Duration
+
+	mu     sync.Mutex
+	models []*warmModel
+}
+
+// startWarmup begins loading the configured models; it returns at once
+func (s *Server) startWarmup() *warmer {
+	wm := &warmer{interval: s.cfg.HotModelsInterval}
+	add := func(model string, hot bool) {
+		name, backend, upstream := s.llm.Route(model)
+		m := &warmModel{Model: model, Backend: name, Hot: hot, State: "pending", upstream: upstream}
+		if client, ok := backend.(*ollama.Client); ok {
+			m.client = client
+		} else {
+			m.State, m.Error = "failed", "not an Ollama backend"
+			log.Printf("warmup: %s: backend %s is not Ollama", model, name)
+		}
+		wm.models = append(wm.models, m)
+	}
+	for _, model := range s.cfg.HotModels {
+		add(model, true)
+	}
+	for _, model := range s.cfg.WarmupModels {
+		if !slices.Contains(s.cfg.HotModels, model) {
+			add(model, false)
+		}
+	}
+	if len(wm.models) > 0 {
+		go wm.run()
+	}
+	return wm
+}
+
+func (wm *warmer) run() {
+	// one at a time: parallel loads fight over the same GPU memory
+	for _, m := range wm.models {
+		if m.client != nil {
+			wm.load(m)
+		}
+	}
+	if wm.interval <= 0 {
+		return
+	}
+	for range time.Tick(wm.interval) {
+		wm.check()
+	}
+}
+
+// load loads m; hot models never expire, the others follow MODEL_KEEP_ALIVE
+func (wm *warmer) load(m *warmModel) {
+	var keepAlive interface{}
+	if m.Hot {
+		keepAlive = -1
+	}
+	wm.set(m, func() { m.State = "loading" })
+	start := time.Now()
+	err := m.client.Load(context.Background(), m.upstream, keepAlive)
+	wm.set(m, func() {
+		if err != nil {
+			m.State, m.Error = "failed", err.Error()
+			return
+		}
+		m.State, m.Error = "loaded", ""
+		m.LoadedAt = time.Now().UTC().Format(time.RFC3339)
+		m.Loads++
+	})
+	if err != nil {
+		log.Printf("warmup: %s: %v", m.Model, err)
+	} else {
+		log.Printf("warmup: %s loaded in %s", m.Model, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// check refreshes every model's state and reloads hot models that are gone
+func (wm *warmer) check() {
+	loaded := map[*ollama.Client]map[string]bool{}
+	errs := map[*ollama.Client]error{}
+	for _, m := range wm.models {
+		if m.client == nil {
+			continue
+		}
+		if _, ok := loaded[m.client]; !ok && errs[m.client] == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			loaded[m.client], errs[m.client] = m.client.Loaded(ctx)
+			cancel()
+		}
+		if err := errs[m.client]; err != nil {
+			wm.set(m, func() { m.Error = err.Error() })
+			continue
+		}
+		if ollama.IsLoaded(loaded[m.client], m.upstream) {
+			wm.set(m, func() { m.State, m.Error = "loaded", "" })
+			continue
+		}
+		if !m.Hot {
+			wm.set(m, func() { m.State = "unloaded" })
+			continue
+		}
+		log.Printf("warmup: hot model %s is not loaded; reloading", m.Model)
+		wm.load(m)
+	}
+}
+
+func (wm *warmer) set(m *warmModel, f func()) {
+	wm.mu.Lock()
+	f()
+	wm.mu.Unlock()
+}
+
+// status returns a copy of the model states
+func (wm *warmer) status() []warmModel {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	out := make([]warmModel, len(wm.models))
+	for i, m := range wm.models {
+		out[i] = *m
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/calvarado2004/LlamaMux/internal/upstream"
+)
+
+// Client talks to a whisper.cpp / faster-whisper style HTTP server.
+// BaseURL is the full inference endpoint, e.g. http://host:8080/inference
+// or http://host:8000/v1/audio/transcriptions for OpenAI-compatible servers.
+type Client struct {
+	BaseURL string
+	http    *http.Client
+}
+
+type Segment struct {
+	ID               int     `json:"id"`
+	Start            float64 `json:"start"`
+	End              float64 `json:"end"`
+	Text             string  `json:"text"`
+	AvgLogprob       float64 `json:"avg_logprob,omitempty"`
+	CompressionRatio float64 `json:"compression_ratio,omitempty"`
+	NoSpeechProb     float64 `json:"no_speech_prob,omitempty"`
+}
+
+type Transcription struct {
+	Task     string    `json:"task"`
+	Language string    `json:"language"`
+	Duration float64   `json:"duration"`
+	Text     string    `json:"text"`
+	Segments []Segment `json:"segments"`
+}
+
+type Request struct {
+	Audio       []byte
+	Filename    string
+	Model       string
+	Language    string
+	Prompt      string
+	Temperature *float64
+	Translate   bool
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL: baseURL,
+		http:    &http.Client{Timeout: 300 * time.Second},
+	}
+}
+
+// Transcribe always asks the backend for verbose_json so every output
+// format can be rendered locally from the same segments.
+func (c *Client) Transcribe(ctx context.Context, r Request) (*Transcription, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	filename := r.Filename
+	if filename == "" {
+		filename = "audio.wav"
+	}
+	fw, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, fmt.Errorf("Whisper error: %v", err)
+	}
+	if _, err := fw.Write(r.Audio); err != nil {
+		return nil, fmt.Errorf("Whisper error: %v", err)
+	}
+	w.WriteField("response_format", "verbose_json")
+	if r.Model != "" {
+		w.WriteField("model", r.Model)
+	}
+	if r.Language != "" && !r.Translate {
+		w.WriteField("language", r.Language)
+	}
+	if r.Prompt != "" {
+		w.WriteField("prompt", r.Prompt)
+	}
+	if r.Temperature != nil {
+		w.WriteField("temperature", strconv.FormatFloat(*r.Temperature, 'f', -1, 64))
+	}
+	if r.Translate {
+		// whisper.cpp reads "translate", faster-whisper servers read "task"
+		w.WriteField("translate", "true")
+		w.WriteField("task", "translate")
+	}
+	w.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint(r.Translate), &buf)
+	if err != nil {
+		return nil, fmt.Errorf("Whisper error: %v", err)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, upstream.FromTransport("Whisper", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, upstream.FromStatus("Whisper", resp.StatusCode, body)
+	}
+
+	var t Transcription
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return nil, upstream.BadResponse("Whisper", err)
+	}
+	t.Text = strings.TrimSpace(t.Text)
+	if t.Task == "" {
+		t.Task = "transcribe"
+		if r.Translate {
+			t.Task = "translate"
+		}
+	}
+	if len(t.Segments) == 0 && t.Text != "" {
+		t.Segments = []Segment{{Start: 0, End: t.Duration, Text: t.Text}}
+	}
+	for i := range t.Segments {
+		t.Segments[i].ID = i
+	}
+	return &t, nil
+}
+
+// endpoint maps OpenAI-compatible transcription URLs to their translation twin
+func (c *Client) endpoint(translate bool) string {
+	if translate && strings.HasSuffix(c.BaseURL, "/audio/transcriptions") {
+		return strings.TrimSuffix(c.BaseURL, "/audio/transcriptions") + "/audio/translations"
+	}
+	return c.BaseURL
+}
+
+// HealthCheck simple GET on the server root
+func (c *Client) HealthCheck() (string, error) {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("GET", u.Scheme+"://"+u.Host+"/", nil)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 500 {
+		return "ok", nil
+	}
+	return fmt.Sprintf("bad:%d", resp.StatusCode), nil
+}
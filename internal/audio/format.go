@@ -0,0 +1,36 @@
+package audio
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SRT renders the segments as SubRip subtitles
+func (t *Transcription) SRT() string {
+	var sb strings.Builder
+	for i, s := range t.Segments {
+		fmt.Fprintf(&sb, "%d\n%s --> %s\n%s\n\n", i+1, timestamp(s.Start, ","), timestamp(s.End, ","), strings.TrimSpace(s.Text))
+	}
+	return sb.String()
+}
+
+// VTT renders the segments as WebVTT
+func (t *Transcription) VTT() string {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n\n")
+	for _, s := range t.Segments {
+		fmt.Fprintf(&sb, "%s --> %s\n%s\n\n", timestamp(s.Start, "."), timestamp(s.End, "."), strings.TrimSpace(s.Text))
+	}
+	return sb.String()
+}
+
+func timestamp(sec float64, msSep string) string {
+	if sec < 0 {
+		sec = 0
+	}
+	ms := int64(sec*1000 + 0.5)
+	h := ms / 3600000
+	m := ms / 60000 % 60
+	s := ms / 1000 % 60
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", h, m, s, msSep, ms%1000)
+}
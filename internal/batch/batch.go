@@ -0,0 +1,653 @@
+// Package batch runs OpenAI-style batches: a JSONL file of requests is run
+// in the background and the answers are written to output and error files.
+// Batches are persisted so they survive restarts and resume where they
+// stopped.
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/calvarado2004/LlamaMux/internal/files"
+)
+
+var ErrNotFound = errors.New("batch not found")
+
+const (
+	StatusValidating = "validating"
+	StatusFailed     = "failed"
+	StatusInProgress = "in_progress"
+	StatusFinalizing = "finalizing"
+	StatusCompleted  = "completed"
+	StatusExpired    = "expired"
+	StatusCancelling = "cancelling"
+	StatusCancelled  = "cancelled"
+)
+
+// Window is the only completion window accepted
+const Window = "24h"
+
+type Counts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type LineError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+	Line    int    `json:"line,omitempty"`
+}
+
+type Errors struct {
+	Object string      `json:"object"`
+	Data   []LineError `json:"data"`
+}
+
+// Batch is the OpenAI batch object
+type Batch struct {
+	ID               string            `json:"id"`
+	Object           string            `json:"object"`
+	Endpoint         string            `json:"endpoint"`
+	Errors           *Errors           `json:"errors"`
+	InputFileID      string            `json:"input_file_id"`
+	CompletionWindow string            `json:"completion_window"`
+	Status           string            `json:"status"`
+	OutputFileID     string            `json:"output_file_id,omitempty"`
+	ErrorFileID      string            `json:"error_file_id,omitempty"`
+	CreatedAt        int64             `json:"created_at"`
+	InProgressAt     int64             `json:"in_progress_at,omitempty"`
+	ExpiresAt        int64             `json:"expires_at"`
+	FinalizingAt     int64             `json:"finalizing_at,omitempty"`
+	CompletedAt      int64             `json:"completed_at,omitempty"`
+	FailedAt         int64             `json:"failed_at,omitempty"`
+	ExpiredAt        int64             `json:"expired_at,omitempty"`
+	CancellingAt     int64             `json:"cancelling_at,omitempty"`
+	CancelledAt      int64             `json:"cancelled_at,omitempty"`
+	RequestCounts    Counts            `json:"request_counts"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	// Owner is who created the batch, as for files.File; it also owns the
+	// output files
+	Owner string `json:"-"`
+}
+
+// stored is a batch as saved on disk
+type stored struct {
+	*Batch
+	Owner string `json:"owner,omitempty"`
+}
+
+// RunFunc answers one request of a batch, on behalf of the batch's owner,
+// with an HTTP status and body
+type RunFunc func(ctx context.Context, batchID, owner, endpoint string, body json.RawMessage) (int, json.RawMessage)
+
+type Config struct {
+	Dir string
+	// Endpoints lists the URLs a batch may target
+	Endpoints []string
+	// Concurrency is how many requests of a batch run at once
+	Concurrency int
+	MaxLines    int
+}
+
+type Manager struct {
+	cfg   Config
+	files *files.Store
+	run   RunFunc
+
+	mu      sync.Mutex
+	batches map[string]*Batch
+	cancels map[string]context.CancelFunc
+	pending []string
+	wake    chan struct{}
+}
+
+// New loads the batches in cfg.Dir and starts the worker; unfinished
+// batches are queued again
+func New(cfg Config, store *files.Store, run RunFunc) (*Manager, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	m := &Manager{
+		cfg:     cfg,
+		files:   store,
+		run:     run,
+		batches: map[string]*Batch{},
+		cancels: map[string]context.CancelFunc{},
+		wake:    make(chan struct{}, 1),
+	}
+	paths, _ := filepath.Glob(filepath.Join(cfg.Dir, "batch_*.json"))
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		rec := stored{Batch: &Batch{}}
+		if err := json.Unmarshal(b, &rec); err != nil {
+			log.Printf("batch: skipping %s: %v", p, err)
+			continue
+		}
+		bt := rec.Batch
+		bt.Owner = rec.Owner
+		m.batches[bt.ID] = bt
+		switch bt.Status {
+		case StatusValidating, StatusInProgress, StatusFinalizing, StatusCancelling:
+			m.pending = append(m.pending, bt.ID)
+		}
+	}
+	sort.Slice(m.pending, func(i, j int) bool {
+		return m.batches[m.pending[i]].CreatedAt < m.batches[m.pending[j]].CreatedAt
+	})
+	if len(m.pending) > 0 {
+		log.Printf("batch: resuming %d unfinished batches", len(m.pending))
+	}
+	go m.worker()
+	return m, nil
+}
+
+// Create validates the request and queues a new batch for owner, who must
+// also own the input file
+func (m *Manager) Create(owner, inputFileID, endpoint, window string, metadata map[string]string) (*Batch, error) {
+	if !slices.Contains(m.cfg.Endpoints, endpoint) {
+		return nil, fmt.Errorf("endpoint must be one of %s", strings.Join(m.cfg.Endpoints, ", "))
+	}
+	if window != Window {
+		return nil, fmt.Errorf("completion_window must be %q", Window)
+	}
+	f, err := m.files.Get(inputFileID)
+	if err == nil && f.Owner != owner {
+		err = files.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("input file %s: %w", inputFileID, err)
+	}
+	if f.Purpose != "batch" {
+		return nil, fmt.Errorf("input file %s has purpose %q, not \"batch\"", inputFileID, f.Purpose)
+	}
+
+	now := time.Now()
+	b := &Batch{
+		ID:               "batch_" + randomHex(12),
+		Object:           "batch",
+		Endpoint:         endpoint,
+		InputFileID:      inputFileID,
+		CompletionWindow: window,
+		Status:           StatusValidating,
+		CreatedAt:        now.Unix(),
+		ExpiresAt:        now.Add(24 * time.Hour).Unix(),
+		Metadata:         metadata,
+		Owner:            owner,
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.save(b); err != nil {
+		return nil, err
+	}
+	m.batches[b.ID] = b
+	m.pending = append(m.pending, b.ID)
+	m.signal()
+	return snapshot(b), nil
+}
+
+// Get returns owner's batch id
+func (m *Manager) Get(owner, id string) (*Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.batches[id]
+	if !ok || b.Owner != owner {
+		return nil, ErrNotFound
+	}
+	return snapshot(b), nil
+}
+
+// List returns up to limit batches of owner, newest first, after the batch
+// with ID after (if set), and whether there are more
+func (m *Manager) List(owner, after string, limit int) ([]*Batch, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	all := []*Batch{}
+	for _, b := range m.batches {
+		if b.Owner == owner {
+			all = append(all, snapshot(b))
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].CreatedAt != all[j].CreatedAt {
+			return all[i].CreatedAt > all[j].CreatedAt
+		}
+		return all[i].ID > all[j].ID
+	})
+	if after != "" {
+		for i, b := range all {
+			if b.ID == after {
+				all = all[i+1:]
+				break
+			}
+		}
+	}
+	if limit > 0 && len(all) > limit {
+		return all[:limit], true
+	}
+	return all, false
+}
+
+// Cancel stops owner's batch id. Requests already answered are kept and
+// written to the output files.
+func (m *Manager) Cancel(owner, id string) (*Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.batches[id]
+	if !ok || b.Owner != owner {
+		return nil, ErrNotFound
+	}
+	switch b.Status {
+	case StatusValidating, StatusInProgress:
+		b.Status = StatusCancelling
+		b.CancellingAt = time.Now().Unix()
+		m.save(b)
+		if cancel := m.cancels[id]; cancel != nil {
+			cancel()
+		}
+	case StatusCancelling, StatusCancelled:
+	default:
+		return nil, fmt.Errorf("cannot cancel a batch that is %s", b.Status)
+	}
+	return snapshot(b), nil
+}
+
+// InUse reports whether an unfinished batch reads fileID, which must then
+// not be deleted
+func (m *Manager) InUse(fileID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range m.batches {
+		switch b.Status {
+		case StatusValidating, StatusInProgress, StatusFinalizing, StatusCancelling:
+			if b.InputFileID == fileID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *Manager) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// worker runs queued batches one at a time, oldest first
+func (m *Manager) worker() {
+	for {
+		m.mu.Lock()
+		var id string
+		if len(m.pending) > 0 {
+			id, m.pending = m.pending[0], m.pending[1:]
+		}
+		m.mu.Unlock()
+		if id == "" {
+			<-m.wake
+			continue
+		}
+		m.process(id)
+	}
+}
+
+// line is one request of the input file
+type line struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// result is one answered request, as kept in the partial results file
+type result struct {
+	Line   int             `json:"line"`
+	OK     bool            `json:"ok"`
+	Record json.RawMessage `json:"record"`
+}
+
+func (m *Manager) process(id string) {
+	m.mu.Lock()
+	b := m.batches[id]
+	status := b.Status
+	m.mu.Unlock()
+	if status == StatusFinalizing || status == StatusCancelling {
+		m.finalize(b, "")
+		return
+	}
+
+	lines, errs, err := m.readInput(b)
+	if err != nil || len(errs) > 0 {
+		m.mu.Lock()
+		if err != nil {
+			errs = []LineError{{Code: "invalid_file", Message: err.Error()}}
+		}
+		b.Status, b.FailedAt = StatusFailed, time.Now().Unix()
+		b.Errors = &Errors{Object: "list", Data: errs}
+		m.save(b)
+		m.mu.Unlock()
+		log.Printf("batch %s: failed validation: %s", id, errs[0].Message)
+		return
+	}
+
+	done := m.readResults(id)
+	ctx, cancel := context.WithDeadline(context.Background(), time.Unix(b.ExpiresAt, 0))
+	defer cancel()
+	m.mu.Lock()
+	if b.Status == StatusCancelling {
+		m.mu.Unlock()
+		m.finalize(b, "")
+		return
+	}
+	m.cancels[id] = cancel
+	if b.Status == StatusValidating {
+		b.Status, b.InProgressAt = StatusInProgress, time.Now().Unix()
+	}
+	b.RequestCounts = Counts{Total: len(lines)}
+	for _, r := range done {
+		if r.OK {
+			b.RequestCounts.Completed++
+		} else {
+			b.RequestCounts.Failed++
+		}
+	}
+	m.save(b)
+	m.mu.Unlock()
+	log.Printf("batch %s: running %d requests (%d already done)", id, len(lines), len(done))
+
+	out, err := os.OpenFile(m.resultsPath(id), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("batch %s: %v", id, err)
+		return
+	}
+	var (
+		wg    sync.WaitGroup
+		outMu sync.Mutex
+		sem   = make(chan struct{}, m.cfg.Concurrency)
+	)
+	for i, l := range lines {
+		if _, ok := done[i]; ok {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, l line) {
+			defer func() { <-sem; wg.Done() }()
+			status, body := m.runLine(ctx, id, b.Owner, b.Endpoint, l.Body)
+			if ctx.Err() != nil {
+				// cancelled or expired mid-request: not answered
+				return
+			}
+			ok := status >= 200 && status < 300
+			rec := record(l.CustomID, status, body)
+			entry, _ := json.Marshal(result{Line: i, OK: ok, Record: rec})
+			outMu.Lock()
+			out.Write(append(entry, '\n'))
+			outMu.Unlock()
+
+			m.mu.Lock()
+			if ok {
+				b.RequestCounts.Completed++
+			} else {
+				b.RequestCounts.Failed++
+			}
+			m.save(b)
+			m.mu.Unlock()
+		}(i, l)
+	}
+	wg.Wait()
+	out.Close()
+
+	m.mu.Lock()
+	delete(m.cancels, id)
+	m.mu.Unlock()
+	expired := ""
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		expired = "batch_expired"
+	}
+	m.finalize(b, expired)
+}
+
+// runLine answers one line. A panic while answering it fails that line
+// with a 500 rather than taking the server down.
+func (m *Manager) runLine(ctx context.Context, id, owner, endpoint string, body json.RawMessage) (status int, resp json.RawMessage) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("batch %s: panic: %v\n%s", id, r, debug.Stack())
+			status = 500
+			resp, _ = json.Marshal(map[string]interface{}{
+				"error": map[string]interface{}{"message": "internal error", "type": "server_error", "param": nil, "code": nil},
+			})
+		}
+	}()
+	return m.run(ctx, id, owner, endpoint, body)
+}
+
+// finalize writes the output and error files. Requests never answered are
+// reported in the error file with code expired, if set.
+func (m *Manager) finalize(b *Batch, expired string) {
+	m.mu.Lock()
+	cancelled := b.Status == StatusCancelling
+	b.Status, b.FinalizingAt = StatusFinalizing, time.Now().Unix()
+	m.save(b)
+	m.mu.Unlock()
+
+	done := m.readResults(b.ID)
+	var output, failed bytes.Buffer
+	lines := make([]int, 0, len(done))
+	for i := range done {
+		lines = append(lines, i)
+	}
+	sort.Ints(lines)
+	for _, i := range lines {
+		dst := &failed
+		if done[i].OK {
+			dst = &output
+		}
+		dst.Write(done[i].Record)
+		dst.WriteByte('\n')
+	}
+	if expired != "" {
+		if input, _, err := m.readInput(b); err == nil {
+			for i, l := range input {
+				if _, ok := done[i]; !ok {
+					rec, _ := json.Marshal(map[string]interface{}{
+						"id":        "batch_req_" + randomHex(12),
+						"custom_id": l.CustomID,
+						"response":  nil,
+						"error":     LineError{Code: expired, Message: "this request could not be executed before the completion window expired"},
+					})
+					failed.Write(append(rec, '\n'))
+				}
+			}
+		}
+	}
+
+	var outID, errID string
+	var err error
+	if output.Len() > 0 {
+		var f *files.File
+		if f, err = m.files.Create(b.ID+"_output.jsonl", "batch_output", b.Owner, &output); err == nil {
+			outID = f.ID
+		}
+	}
+	if err == nil && failed.Len() > 0 {
+		var f *files.File
+		if f, err = m.files.Create(b.ID+"_error.jsonl", "batch_output", b.Owner, &failed); err == nil {
+			errID = f.ID
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().Unix()
+	b.OutputFileID, b.ErrorFileID = outID, errID
+	switch {
+	case err != nil:
+		b.Status, b.FailedAt = StatusFailed, now
+		b.Errors = &Errors{Object: "list", Data: []LineError{{Code: "output_failed", Message: err.Error()}}}
+	case cancelled:
+		b.Status, b.CancelledAt = StatusCancelled, now
+	case expired != "":
+		b.Status, b.ExpiredAt = StatusExpired, now
+	default:
+		b.Status, b.CompletedAt = StatusCompleted, now
+	}
+	m.save(b)
+	if err == nil {
+		os.Remove(m.resultsPath(b.ID))
+	}
+	log.Printf("batch %s: %s (%d completed, %d failed)", b.ID, b.Status, b.RequestCounts.Completed, b.RequestCounts.Failed)
+}
+
+// record is an output file line in OpenAI's format
+func record(customID string, status int, body json.RawMessage) json.RawMessage {
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	rec, _ := json.Marshal(map[string]interface{}{
+		"id":        "batch_req_" + randomHex(12),
+		"custom_id": customID,
+		"response": map[string]interface{}{
+			"status_code": status,
+			"request_id":  "req_" + randomHex(12),
+			"body":        body,
+		},
+		"error": nil,
+	})
+	return rec
+}
+
+// readInput parses and checks the input file. errs lists invalid lines.
+func (m *Manager) readInput(b *Batch) ([]line, []LineError, error) {
+	_, rc, err := m.files.Open(b.InputFileID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+
+	var (
+		lines []line
+		errs  []LineError
+		seen  = map[string]bool{}
+	)
+	fail := func(n int, code, msg string) {
+		if len(errs) < 100 {
+			errs = append(errs, LineError{Code: code, Message: msg, Line: n})
+		}
+	}
+	sc := bufio.NewScanner(rc)
+	sc.Buffer(make([]byte, 64*1024), 64<<20)
+	for n := 1; sc.Scan(); n++ {
+		text := bytes.TrimSpace(sc.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var l line
+		switch {
+		case json.Unmarshal(text, &l) != nil:
+			fail(n, "invalid_json_line", "line is not a JSON object")
+		case l.CustomID == "":
+			fail(n, "missing_required_parameter", "custom_id is required")
+		case seen[l.CustomID]:
+			fail(n, "duplicate_custom_id", fmt.Sprintf("custom_id %q is used more than once", l.CustomID))
+		case l.Method != "POST":
+			fail(n, "invalid_method", "method must be POST")
+		case l.URL != b.Endpoint:
+			fail(n, "mismatched_endpoint", fmt.Sprintf("url %q does not match the batch endpoint %s", l.URL, b.Endpoint))
+		case len(l.Body) == 0 || l.Body[0] != '{':
+			fail(n, "invalid_request", "body must be a JSON object")
+		default:
+			seen[l.CustomID] = true
+			lines = append(lines, l)
+		}
+		if m.cfg.MaxLines > 0 && len(lines) > m.cfg.MaxLines {
+			return nil, nil, fmt.Errorf("input has more than %d requests", m.cfg.MaxLines)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(lines) == 0 && len(errs) == 0 {
+		errs = append(errs, LineError{Code: "empty_file", Message: "input file has no requests"})
+	}
+	return lines, errs, nil
+}
+
+// readResults loads the answers recorded so far; a line cut short by a
+// crash is ignored and its request runs again
+func (m *Manager) readResults(id string) map[int]result {
+	done := map[int]result{}
+	f, err := os.Open(m.resultsPath(id))
+	if err != nil {
+		return done
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		b, err := r.ReadBytes('\n')
+		var res result
+		if len(b) > 0 && json.Unmarshal(b, &res) == nil {
+			done[res.Line] = res
+		}
+		if err != nil {
+			return done
+		}
+	}
+}
+
+// save writes b's JSON; callers hold m.mu
+func (m *Manager) save(b *Batch) error {
+	data, _ := json.Marshal(stored{Batch: b, Owner: b.Owner})
+	name := filepath.Join(m.cfg.Dir, b.ID+".json")
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("batch %s: saving: %v", b.ID, err)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (m *Manager) resultsPath(id string) string {
+	return filepath.Join(m.cfg.Dir, id+".results.jsonl")
+}
+
+func snapshot(b *Batch) *Batch {
+	c := *b
+	return &c
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,292 @@
+// Package cache is a small LRU keyed by content hash, with an optional
+// TTL and optional persistence to disk. The files on disk follow the entries
+// in memory: an evicted entry loses its file, and files past the TTL or over
+// MaxEntries/MaxBytes (oldest first) are pruned at startup and periodically.
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	MaxEntries int
+	MaxBytes   int64
+	TTL        time.Duration
+	Dir        string
+}
+
+// Stats are cumulative counters plus the current size
+type Stats struct {
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	Hits      uint64 `json:"hits"`
+	DiskHits  uint64 `json:"disk_hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+type Cache struct {
+	cfg   Config
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	bytes int64
+	stats Stats
+}
+
+// New returns a cache; MaxEntries <= 0 gives a cache that never stores anything.
+func New(cfg Config) *Cache {
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			cfg.Dir = ""
+		}
+	}
+	c := &Cache{
+		cfg:   cfg,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+	if cfg.Dir != "" && cfg.MaxEntries > 0 {
+		go c.pruneLoop()
+	}
+	return c
+}
+
+// Key is the hex SHA-256 of data
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) Get(key string) ([]byte, bool) {
+	if c.cfg.MaxEntries <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		if c.cfg.TTL <= 0 || time.Now().Before(e.expires) {
+			c.ll.MoveToFront(el)
+			c.stats.Hits++
+			c.mu.Unlock()
+			return e.value, true
+		}
+		c.remove(el)
+	}
+	c.mu.Unlock()
+
+	// disk reads happen without the lock so a slow disk only delays
+	// lookups that miss memory
+	v, mod, ok := c.readDisk(key)
+
+	c.mu.Lock()
+	if !ok {
+		c.stats.Misses++
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.stats.DiskHits++
+	if el, ok := c.items[key]; ok {
+		// a Put or another Get got there first
+		c.remove(el)
+	}
+	evicted := c.add(key, v, mod)
+	c.mu.Unlock()
+
+	c.removeDisk(evicted)
+	return v, true
+}
+
+func (c *Cache) Put(key string, value []byte) {
+	if c.cfg.MaxEntries <= 0 {
+		return
+	}
+	if c.cfg.MaxBytes > 0 && int64(len(value)) > c.cfg.MaxBytes {
+		return
+	}
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	evicted := c.add(key, value, time.Now())
+	c.mu.Unlock()
+
+	c.writeDisk(key, value)
+	c.removeDisk(evicted)
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Entries = c.ll.Len()
+	s.Bytes = c.bytes
+	return s
+}
+
+// add inserts an entry stored at the given time, evicts down to the limits
+// and returns the evicted keys, whose files the caller removes unlocked
+func (c *Cache) add(key string, value []byte, stored time.Time) []string {
+	e := &entry{key: key, value: value, expires: stored.Add(c.cfg.TTL)}
+	c.items[key] = c.ll.PushFront(e)
+	c.bytes += int64(len(value))
+
+	var evicted []string
+	for c.ll.Len() > c.cfg.MaxEntries || (c.cfg.MaxBytes > 0 && c.bytes > c.cfg.MaxBytes) {
+		evicted = append(evicted, c.ll.Back().Value.(*entry).key)
+		c.remove(c.ll.Back())
+		c.stats.Evictions++
+	}
+	return evicted
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	c.ll.Remove(el)
+	delete(c.items, e.key)
+	c.bytes -= int64(len(e.value))
+}
+
+func (c *Cache) path(key string) string {
+	if len(key) < 2 {
+		return filepath.Join(c.cfg.Dir, key)
+	}
+	return filepath.Join(c.cfg.Dir, key[:2], key)
+}
+
+func (c *Cache) readDisk(key string) ([]byte, time.Time, bool) {
+	if c.cfg.Dir == "" {
+		return nil, time.Time{}, false
+	}
+	p := c.path(key)
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	if c.cfg.TTL > 0 && time.Since(fi.ModTime()) > c.cfg.TTL {
+		os.Remove(p)
+		return nil, time.Time{}, false
+	}
+	v, err := os.ReadFile(p)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	return v, fi.ModTime(), true
+}
+
+// pruneLoop prunes Dir now and then every TTL, at least once a minute and
+// at most once an hour (hourly without a TTL)
+func (c *Cache) pruneLoop() {
+	interval := time.Hour
+	if c.cfg.TTL > 0 {
+		interval = min(max(c.cfg.TTL, time.Minute), time.Hour)
+	}
+	for {
+		if n := c.prune(); n > 0 {
+			log.Printf("cache: pruned %d files from %s", n, c.cfg.Dir)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// staleTemp is the age at which a temporary file is taken to be left behind
+// by an interrupted write
+const staleTemp = time.Hour
+
+// prune removes files in Dir older than TTL and then the oldest ones until
+// the rest fit MaxEntries and MaxBytes. It also removes stale temporary
+// files, and returns how many cache files it removed.
+func (c *Cache) prune() int {
+	type file struct {
+		path string
+		size int64
+		mod  time.Time
+	}
+	var files []file
+	n := 0
+	now := time.Now()
+	filepath.WalkDir(c.cfg.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		switch {
+		case strings.HasPrefix(d.Name(), ".tmp-"):
+			if now.Sub(fi.ModTime()) > staleTemp {
+				os.Remove(p)
+			}
+		case c.cfg.TTL > 0 && now.Sub(fi.ModTime()) > c.cfg.TTL:
+			if os.Remove(p) == nil {
+				n++
+			}
+		default:
+			files = append(files, file{p, fi.Size(), fi.ModTime()})
+		}
+		return nil
+	})
+
+	sort.Slice(files, func(i, j int) bool { return files[i].mod.After(files[j].mod) })
+	var kept int
+	var bytes int64
+	for _, f := range files {
+		if kept < c.cfg.MaxEntries && (c.cfg.MaxBytes <= 0 || bytes+f.size <= c.cfg.MaxBytes) {
+			kept++
+			bytes += f.size
+			continue
+		}
+		if os.Remove(f.path) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// removeDisk deletes the files of evicted keys
+func (c *Cache) removeDisk(keys []string) {
+	if c.cfg.Dir == "" {
+		return
+	}
+	for _, key := range keys {
+		os.Remove(c.path(key))
+	}
+}
+
+func (c *Cache) writeDisk(key string, value []byte) {
+	if c.cfg.Dir == "" {
+		return
+	}
+	p := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	os.Rename(f.Name(), p)
+}
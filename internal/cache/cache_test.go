@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiskHit(t *testing.T) {
+	dir := t.TempDir()
+	key := Key([]byte("in"))
+	New(Config{MaxEntries: 4, Dir: dir}).Put(key, []byte("out"))
+
+	c := New(Config{MaxEntries: 4, Dir: dir})
+	if v, ok := c.Get(key); !ok || string(v) != "out" {
+		t.Fatalf("Get = %q, %v", v, ok)
+	}
+	if v, ok := c.Get(key); !ok || string(v) != "out" {
+		t.Fatalf("second Get = %q, %v", v, ok)
+	}
+	if s := c.Stats(); s.DiskHits != 1 || s.Hits != 1 || s.Entries != 1 {
+		t.Errorf("stats %+v", s)
+	}
+}
+
+func TestConcurrentDiskGets(t *testing.T) {
+	dir := t.TempDir()
+	keys := make([]string, 8)
+	for i := range keys {
+		keys[i] = Key([]byte{byte(i)})
+		New(Config{MaxEntries: 16, Dir: dir}).Put(keys[i], []byte{byte(i)})
+	}
+
+	c := New(Config{MaxEntries: 16, Dir: dir})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, key := range keys {
+				if v, ok := c.Get(key); !ok || v[0] != byte(i) {
+					t.Errorf("Get %d = %v, %v", i, v, ok)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if s := c.Stats(); s.Entries != len(keys) || s.Bytes != int64(len(keys)) {
+		t.Errorf("stats %+v", s)
+	}
+}
+
+// pruner is a cache over dir for calling prune directly, without the
+// background loop New starts
+func pruner(cfg Config) *Cache {
+	return &Cache{cfg: cfg}
+}
+
+func age(t *testing.T, p string, d time.Duration) {
+	t.Helper()
+	old := time.Now().Add(-d)
+	if err := os.Chtimes(p, old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	c := New(Config{MaxEntries: 4, Dir: dir})
+	fresh, stale := Key([]byte("fresh")), Key([]byte("stale"))
+	c.Put(fresh, []byte("a"))
+	c.Put(stale, []byte("b"))
+	tmp := filepath.Join(dir, ".tmp-123")
+	os.WriteFile(tmp, []byte("c"), 0o644)
+	age(t, c.path(stale), 2*time.Hour)
+	age(t, tmp, 2*time.Hour)
+
+	if n := pruner(Config{MaxEntries: 4, TTL: time.Hour, Dir: dir}).prune(); n != 1 {
+		t.Errorf("pruned %d files, want 1", n)
+	}
+	for p, want := range map[string]bool{c.path(fresh): true, c.path(stale): false, tmp: false} {
+		if _, err := os.Stat(p); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", p, err == nil, want)
+		}
+	}
+}
+
+func TestPruneLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		kept []int // indexes of the files left, newest is 0
+	}{
+		{"entries", Config{MaxEntries: 2}, []int{0, 1}},
+		{"bytes", Config{MaxEntries: 10, MaxBytes: 25}, []int{0, 1}},
+		{"no TTL keeps everything within limits", Config{MaxEntries: 10}, []int{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w := pruner(Config{Dir: dir})
+			paths := make([]string, 4)
+			for i := range paths {
+				key := Key([]byte{byte(i)})
+				w.writeDisk(key, make([]byte, 10))
+				paths[i] = w.path(key)
+				age(t, paths[i], time.Duration(i)*time.Minute)
+			}
+			tt.cfg.Dir = dir
+			pruner(tt.cfg).prune()
+			for i, p := range paths {
+				_, err := os.Stat(p)
+				if want := slices.Contains(tt.kept, i); (err == nil) != want {
+					t.Errorf("file %d exists = %v, want %v", i, err == nil, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvictionRemovesFile(t *testing.T) {
+	dir := t.TempDir()
+	c := New(Config{MaxEntries: 1, Dir: dir})
+	first, second := Key([]byte("1")), Key([]byte("2"))
+	c.Put(first, []byte("a"))
+	c.Put(second, []byte("b"))
+	if _, err := os.Stat(c.path(first)); err == nil {
+		t.Error("evicted entry still has a file")
+	}
+	if _, err := os.Stat(c.path(second)); err != nil {
+		t.Errorf("cached entry lost its file: %v", err)
+	}
+}
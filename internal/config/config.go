@@ -3,15 +3,106 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	OllamaURL    string
 	SDWebUIURL   string
 	OCRURL       string
+	WhisperURL   string
+	TTSURL       string
 	ServerName   string
 	OllamaNumCtx int
 	ListenAddr   string
+
+	// Bearer token for the /admin endpoints; empty disables them
+	AdminKey string
+	// Pull models Ollama does not have on first use; only models named here
+	// or in MODEL_ROUTES, WARMUP_MODELS and HOT_MODELS are pulled
+	AutoPull       bool
+	AutoPullModels []string
+	// keep_alive per model or glob ("llama3:8b=1h,qwen*=-1")
+	ModelKeepAlive map[string]string
+	// Models loaded in the background at startup
+	WarmupModels []string
+	// Models kept resident, re-loaded when Ollama evicts them
+	HotModels         []string
+	HotModelsInterval time.Duration
+
+	// Extra LLM backends ("name=openai:http://host:8000/v1") and model routing
+	LLMBackends    map[string]string
+	LLMBackendKeys map[string]string
+	ModelRoutes    map[string]string
+	// Backends a stream moves to when it fails before its first token
+	LLMFallbacks []string
+
+	// Admission control: concurrent requests per model (default and by
+	// name or glob) and per backend, and the queue for the rest
+	ModelConcurrency   int
+	ModelConcurrencies map[string]int
+	BackendConcurrency map[string]int
+	QueueMax           int
+	QueueMaxPerKey     int
+	QueueTimeout       time.Duration
+	// Priority classes by API key and by default, batch's minimum share of
+	// admissions, and preemption of batch requests
+	KeyPriorities   map[string]string
+	DefaultPriority string
+	BatchMinShare   float64
+	PreemptBatch    bool
+
+	// Extra attempts when output does not match response_format
+	StructuredRetries int
+	// Upper bound for n on chat completions
+	MaxChoices int
+	// Drop reasoning from responses instead of returning it
+	HideReasoning bool
+
+	// Context window management
+	ContextStrategy string
+	ContextKeepLast int
+	ContextReserve  int
+	ContextMax      int
+	// Summaries replacing dropped turns (CONTEXT_STRATEGY=summarize)
+	SummaryModel        string
+	SummaryMaxTokens    int
+	SummaryChunkTokens  int
+	SummaryCacheEntries int
+
+	// Text-to-speech backend
+	TTSAPI          string
+	TTSVoices       map[string]string
+	TTSDefaultVoice string
+
+	// Document (PDF/TIFF) handling
+	DocMaxPages       int
+	DocMaxBytes       int
+	DocOCRConcurrency int
+
+	// Image parts in chat messages
+	ImageWorkers  int
+	ImageDeadline time.Duration
+
+	// Remote image/document fetching
+	FetchTimeout      time.Duration
+	FetchMaxBytes     int
+	FetchMaxRedirects int
+	FetchAllow        string
+
+	// Uploaded files and batches, kept under DataDir (absolute, so storage
+	// does not depend on the working directory)
+	DataDir          string
+	FilesMaxBytes    int
+	BatchConcurrency int
+	BatchMaxLines    int
+
+	// OCR result and transcript caches, keyed by content hash
+	OCRCacheEntries   int
+	AudioCacheEntries int
+	CacheTTL          time.Duration
+	CacheDir          string
 }
 
 func getenv(key, def string) string {
@@ -33,14 +124,159 @@ func getEnvInt(key string, def int) int {
 	return i
 }
 
+// getEnvPositiveInt is getEnvInt for settings that must be above zero
+func getEnvPositiveInt(key string, def int) int {
+	if n := getEnvInt(key, def); n > 0 {
+		return n
+	}
+	return def
+}
+
+func getEnvFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
+func getEnvBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+// getEnvMap parses "a=b,c=d" into a map
+func getEnvMap(key string) map[string]string {
+	out := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return out
+}
+
+// getEnvIntMap parses "a=1,b=2", skipping values that are not integers
+func getEnvIntMap(key string) map[string]int {
+	out := map[string]int{}
+	for k, v := range getEnvMap(key) {
+		if n, err := strconv.Atoi(v); err == nil {
+			out[k] = n
+		}
+	}
+	return out
+}
+
+// getEnvList parses "a,b,c", skipping empty items
+func getEnvList(key string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func Load() Config {
 	return Config{
 		OllamaURL:    getenv("OLLAMA_URL", "http://192.168.1.88:11434"),
 		SDWebUIURL:   getenv("SD_WEBUI_URL", "http://192.168.122.1:7860"),
 		OCRURL:       getenv("OCR_URL", "http://192.168.122.1:5055/ocr"),
+		WhisperURL:   getenv("WHISPER_URL", "http://192.168.122.1:8080/inference"),
+		TTSURL:       getenv("TTS_URL", "http://192.168.122.1:5000/"),
 		ServerName:   getenv("SERVER_NAME", "LlamaMux"),
-		OllamaNumCtx: getEnvInt("OLLAMA_NUM_CTX", 8192),
+		OllamaNumCtx: getEnvPositiveInt("OLLAMA_NUM_CTX", 8192),
 		ListenAddr:   getenv("LLAMAMUX_ADDR", ":8001"),
+
+		AdminKey:       getenv("LLAMAMUX_ADMIN_KEY", ""),
+		AutoPull:       getEnvBool("OLLAMA_AUTO_PULL", false),
+		AutoPullModels: getEnvList("OLLAMA_AUTO_PULL_MODELS"),
+
+		ModelKeepAlive:    getEnvMap("MODEL_KEEP_ALIVE"),
+		WarmupModels:      getEnvList("WARMUP_MODELS"),
+		HotModels:         getEnvList("HOT_MODELS"),
+		HotModelsInterval: getEnvDuration("HOT_MODELS_INTERVAL", time.Minute),
+
+		LLMBackends:    getEnvMap("LLM_BACKENDS"),
+		LLMBackendKeys: getEnvMap("LLM_BACKEND_KEYS"),
+		ModelRoutes:    getEnvMap("MODEL_ROUTES"),
+		LLMFallbacks:   getEnvList("LLM_FALLBACKS"),
+
+		ModelConcurrency:   getEnvInt("MAX_CONCURRENCY_PER_MODEL", 0),
+		ModelConcurrencies: getEnvIntMap("MODEL_CONCURRENCY"),
+		BackendConcurrency: getEnvIntMap("BACKEND_CONCURRENCY"),
+		QueueMax:           getEnvInt("QUEUE_MAX", 256),
+		QueueMaxPerKey:     getEnvInt("QUEUE_MAX_PER_KEY", 0),
+		QueueTimeout:       getEnvDuration("QUEUE_TIMEOUT", 60*time.Second),
+		KeyPriorities:      getEnvMap("KEY_PRIORITIES"),
+		DefaultPriority:    getenv("DEFAULT_PRIORITY", "interactive"),
+		BatchMinShare:      getEnvFloat("BATCH_MIN_SHARE", 0.1),
+		PreemptBatch:       getEnvBool("PREEMPT_BATCH", false),
+
+		StructuredRetries: getEnvInt("STRUCTURED_OUTPUT_RETRIES", 2),
+		MaxChoices:        getEnvInt("MAX_CHOICES", 8),
+		HideReasoning:     getEnvBool("HIDE_REASONING", false),
+
+		ContextStrategy: getenv("CONTEXT_STRATEGY", "drop_oldest"),
+		ContextKeepLast: getEnvInt("CONTEXT_KEEP_LAST", 20),
+		ContextReserve:  getEnvInt("CONTEXT_RESERVE", 1024),
+		ContextMax:      getEnvInt("CONTEXT_MAX", 0),
+
+		SummaryModel:        getenv("SUMMARY_MODEL", ""),
+		SummaryMaxTokens:    getEnvInt("SUMMARY_MAX_TOKENS", 512),
+		SummaryChunkTokens:  getEnvInt("SUMMARY_CHUNK_TOKENS", 4096),
+		SummaryCacheEntries: getEnvInt("SUMMARY_CACHE_ENTRIES", 256),
+
+		TTSAPI:          getenv("TTS_API", "piper"),
+		TTSVoices:       getEnvMap("TTS_VOICES"),
+		TTSDefaultVoice: getenv("TTS_DEFAULT_VOICE", ""),
+
+		DocMaxPages:       getEnvInt("DOC_MAX_PAGES", 50),
+		DocMaxBytes:       getEnvInt("DOC_MAX_BYTES", 25<<20),
+		DocOCRConcurrency: getEnvInt("DOC_OCR_CONCURRENCY", 4),
+
+		ImageWorkers:  getEnvInt("IMAGE_WORKERS", 4),
+		ImageDeadline: getEnvDuration("IMAGE_DEADLINE", 90*time.Second),
+
+		FetchTimeout:      getEnvDuration("FETCH_TIMEOUT", 15*time.Second),
+		FetchMaxBytes:     getEnvInt("FETCH_MAX_BYTES", 20<<20),
+		FetchMaxRedirects: getEnvInt("FETCH_MAX_REDIRECTS", 3),
+		FetchAllow:        getenv("FETCH_ALLOW", ""),
+
+		DataDir:          getenv("DATA_DIR", "/var/lib/llamamux"),
+		FilesMaxBytes:    getEnvInt("FILES_MAX_BYTES", 512<<20),
+		BatchConcurrency: getEnvInt("BATCH_CONCURRENCY", 4),
+		BatchMaxLines:    getEnvInt("BATCH_MAX_LINES", 50000),
+
+		OCRCacheEntries:   getEnvInt("OCR_CACHE_ENTRIES", 1024),
+		AudioCacheEntries: getEnvInt("AUDIO_CACHE_ENTRIES", 256),
+		CacheTTL:          getEnvDuration("CACHE_TTL", 24*time.Hour),
+		CacheDir:          getenv("CACHE_DIR", ""),
 	}
 }
-
@@ -0,0 +1,91 @@
+// Package document splits multi-page documents (PDF, TIFF) into pages,
+// extracting embedded text where present and page images where it is not.
+package document
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"unicode"
+)
+
+const (
+	KindPDF  = "pdf"
+	KindTIFF = "tiff"
+)
+
+var ErrEncrypted = errors.New("encrypted PDFs are not supported")
+
+// Limits bound how much of a document is processed.
+type Limits struct {
+	MaxPages int
+	MaxBytes int64
+}
+
+// Page is one page of a document. Image is set when the page has
+// little or no embedded text and should go through OCR instead.
+type Page struct {
+	Number    int
+	Text      string
+	Image     []byte
+	ImageName string
+}
+
+type Document struct {
+	Kind       string
+	Pages      []Page
+	TotalPages int
+}
+
+// Truncated reports whether pages were dropped because of Limits.MaxPages
+func (d *Document) Truncated() bool {
+	return len(d.Pages) < d.TotalPages
+}
+
+// Detect returns KindPDF, KindTIFF or "" for anything else
+func Detect(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return KindPDF
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return KindTIFF
+	}
+	return ""
+}
+
+// Split parses a PDF or TIFF into pages, honouring the given limits.
+func Split(data []byte, lim Limits) (*Document, error) {
+	if lim.MaxBytes > 0 && int64(len(data)) > lim.MaxBytes {
+		return nil, fmt.Errorf("document is %d bytes, limit is %d", len(data), lim.MaxBytes)
+	}
+
+	kind := Detect(data)
+	var (
+		pages []Page
+		total int
+		err   error
+	)
+	switch kind {
+	case KindPDF:
+		pages, total, err = splitPDF(data, lim)
+	case KindTIFF:
+		pages, total, err = splitTIFFPages(data, lim.MaxPages)
+	default:
+		return nil, fmt.Errorf("unsupported document type")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Document{Kind: kind, Pages: pages, TotalPages: total}, nil
+}
+
+// hasUsefulText is the threshold below which a page is treated as scanned
+func hasUsefulText(s string) bool {
+	n := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			n++
+		}
+	}
+	return n >= 20
+}
@@ -0,0 +1,158 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// pdfFile numbers objs from 1 and wraps them in a minimal PDF; the parser
+// finds objects by scanning, so no xref table is needed
+func pdfFile(objs ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	for i, o := range objs {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func pdfStreamObj(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+const pageTree = "<< /Type /Catalog /Pages 2 0 R >>"
+
+func pageObj(resources string) string {
+	return "<< /Type /Page /Parent 2 0 R /Resources << " + resources + " >> /Contents 4 0 R >>"
+}
+
+func TestSplitPDF(t *testing.T) {
+	text := "BT /F1 12 Tf (Hello from a well formed test document page) Tj ET"
+	data := pdfFile(
+		pageTree,
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		pageObj("/Font << /F1 5 0 R >>"),
+		pdfStreamObj("/Filter /FlateDecode", deflate([]byte(text))),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+	doc, err := Split(data, Limits{MaxPages: 10, MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Pages) != 1 || !strings.Contains(doc.Pages[0].Text, "well formed") {
+		t.Fatalf("got %+v", doc.Pages)
+	}
+}
+
+// malformedInputs each used to panic, loop or allocate without bound
+func malformedInputs() map[string][]byte {
+	tiffUnknownType := func() []byte {
+		var b bytes.Buffer
+		b.WriteString("II*\x00")
+		binary.Write(&b, binary.LittleEndian, uint32(8))
+		binary.Write(&b, binary.LittleEndian, uint16(1))
+		// tag 273 (StripOffsets), type 99, count 4G
+		binary.Write(&b, binary.LittleEndian, uint16(273))
+		binary.Write(&b, binary.LittleEndian, uint16(99))
+		binary.Write(&b, binary.LittleEndian, uint32(0xffffffff))
+		binary.Write(&b, binary.LittleEndian, uint32(0))
+		binary.Write(&b, binary.LittleEndian, uint32(0))
+		return b.Bytes()
+	}
+	return map[string][]byte{
+		"negative ObjStm First": pdfFile(
+			pageTree,
+			pdfStreamObj("/Type /ObjStm /N 1 /First -1", []byte("9 0 << >>")),
+		),
+		"ObjStm offset past the end": pdfFile(
+			pageTree,
+			pdfStreamObj("/Type /ObjStm /N 1 /First 4", []byte("9 -7 << >>")),
+		),
+		"negative predictor columns": pdfFile(
+			pageTree,
+			pdfStreamObj("/Type /ObjStm /N 1 /First 4 /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns -5 >>", deflate([]byte("9 0 << >>"))),
+		),
+		"huge predictor columns": pdfFile(
+			pageTree,
+			pdfStreamObj("/Type /ObjStm /N 1 /First 4 /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 9e18 /Colors 9e18 >>", deflate([]byte("9 0 << >>"))),
+		),
+		"huge image": pdfFile(
+			pageTree,
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			pageObj("/XObject << /Im1 5 0 R >>"),
+			pdfStreamObj("", []byte("q Q")),
+			pdfStreamObj("/Subtype /Image /Width 4294967296 /Height 4294967296 /ColorSpace /DeviceRGB /BitsPerComponent 8", []byte("abc")),
+		),
+		"image width times height overflows": pdfFile(
+			pageTree,
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			pageObj("/XObject << /Im1 5 0 R >>"),
+			pdfStreamObj("", []byte("q Q")),
+			pdfStreamObj("/Subtype /Image /Width 65536 /Height 65536 /ColorSpace /DeviceGray /BitsPerComponent 1", []byte("abc")),
+		),
+		"negative image size": pdfFile(
+			pageTree,
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			pageObj("/XObject << /Im1 5 0 R >>"),
+			pdfStreamObj("", []byte("q Q")),
+			pdfStreamObj("/Subtype /Image /Width -3 /Height -3 /Filter /CCITTFaxDecode", []byte("abc")),
+		),
+		"deeply nested arrays": pdfFile(
+			pageTree,
+			strings.Repeat("[", 100000),
+		),
+		"deeply nested dictionaries": pdfFile(
+			pageTree,
+			strings.Repeat("<< /A ", 100000),
+		),
+		"TIFF tag of unknown type": tiffUnknownType(),
+	}
+}
+
+func TestSplitMalformed(t *testing.T) {
+	for name, data := range malformedInputs() {
+		t.Run(name, func(t *testing.T) {
+			// must return, with or without an error, and not panic
+			Split(data, Limits{MaxPages: 10, MaxBytes: 1 << 20})
+		})
+	}
+}
+
+func TestInflateLimit(t *testing.T) {
+	bomb := deflate(make([]byte, 4<<20))
+	if _, err := inflate(bomb, 1<<20); err == nil {
+		t.Error("4 MiB stream inflated under a 1 MiB limit")
+	}
+	out, err := inflate(bomb, 4<<20)
+	if err != nil || len(out) != 4<<20 {
+		t.Errorf("got %d bytes, %v", len(out), err)
+	}
+}
+
+func FuzzSplit(f *testing.F) {
+	for _, data := range malformedInputs() {
+		f.Add(data)
+	}
+	f.Add(pdfFile(
+		pageTree,
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		pageObj(""),
+		pdfStreamObj("/Filter /FlateDecode", deflate([]byte("BT (x) Tj ET"))),
+	))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Split(data, Limits{MaxPages: 4, MaxBytes: 1 << 20})
+	})
+}
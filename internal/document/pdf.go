@@ -0,0 +1,525 @@
+package document
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"unicode/utf16"
+)
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+func splitPDF(data []byte, lim Limits) ([]Page, int, error) {
+	maxPages := lim.MaxPages
+	doc, err := parsePDF(data, lim.MaxBytes)
+	if err != nil {
+		return nil, 0, err
+	}
+	if doc.trailer["Encrypt"] != nil {
+		return nil, 0, ErrEncrypted
+	}
+
+	pdfPages := doc.pages()
+	if len(pdfPages) == 0 {
+		return nil, 0, fmt.Errorf("no pages found in PDF")
+	}
+	total := len(pdfPages)
+	if maxPages > 0 && len(pdfPages) > maxPages {
+		pdfPages = pdfPages[:maxPages]
+	}
+
+	var out []Page
+	for i, p := range pdfPages {
+		page := Page{Number: i + 1, Text: doc.pageText(p)}
+		if !hasUsefulText(page.Text) {
+			if img, ext := doc.pageImage(p.resources); img != nil {
+				page.Image = img
+				page.ImageName = fmt.Sprintf("page-%d%s", i+1, ext)
+			}
+		}
+		out = append(out, page)
+	}
+	return out, total, nil
+}
+
+// pages walks the page tree in document order, falling back to every
+// /Type /Page object when the catalog cannot be followed.
+func (d *pdfDoc) pages() []pdfPage {
+	var out []pdfPage
+	visited := map[pdfRef]bool{}
+
+	var walk func(node interface{}, res pdfDict, depth int)
+	walk = func(node interface{}, res pdfDict, depth int) {
+		if depth > 64 {
+			return
+		}
+		if r, ok := node.(pdfRef); ok {
+			if visited[r] {
+				return
+			}
+			visited[r] = true
+		}
+		n := d.dict(node)
+		if n == nil {
+			return
+		}
+		if r := d.dict(n["Resources"]); r != nil {
+			res = r
+		}
+		if kids := d.array(n["Kids"]); kids != nil && n["Type"] != pdfName("Page") {
+			for _, k := range kids {
+				walk(k, res, depth+1)
+			}
+			return
+		}
+		out = append(out, pdfPage{dict: n, resources: res})
+	}
+
+	if root := d.dict(d.trailer["Root"]); root != nil {
+		walk(root["Pages"], nil, 0)
+	}
+	if len(out) > 0 {
+		return out
+	}
+
+	for _, num := range d.sortedNums() {
+		if n, ok := d.objs[num].(pdfDict); ok && n["Type"] == pdfName("Page") {
+			out = append(out, pdfPage{dict: n, resources: d.dict(n["Resources"])})
+		}
+	}
+	return out
+}
+
+// ---------- Text ----------
+
+type pdfFont struct {
+	cmap    map[int]string
+	codeLen int
+}
+
+func (f *pdfFont) decode(s []byte) string {
+	if f == nil {
+		return winAnsi(s)
+	}
+	if f.cmap != nil {
+		var sb strings.Builder
+		for i := 0; i+f.codeLen <= len(s); i += f.codeLen {
+			code := 0
+			for _, b := range s[i : i+f.codeLen] {
+				code = code<<8 | int(b)
+			}
+			sb.WriteString(f.cmap[code])
+		}
+		return sb.String()
+	}
+	if f.codeLen == 2 {
+		// CIDs without a ToUnicode map cannot be mapped back to text
+		return ""
+	}
+	return winAnsi(s)
+}
+
+var winAnsiHigh = map[byte]rune{
+	0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”',
+	0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™',
+}
+
+func winAnsi(s []byte) string {
+	var sb strings.Builder
+	for _, b := range s {
+		if r, ok := winAnsiHigh[b]; ok {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune(rune(b))
+		}
+	}
+	return sb.String()
+}
+
+func (d *pdfDoc) loadFonts(res pdfDict) map[string]*pdfFont {
+	fonts := map[string]*pdfFont{}
+	for name, ref := range d.dict(res["Font"]) {
+		fd := d.dict(ref)
+		if fd == nil {
+			continue
+		}
+		f := &pdfFont{codeLen: 1}
+		if fd["Subtype"] == pdfName("Type0") {
+			f.codeLen = 2
+		}
+		if s := d.stream(fd["ToUnicode"]); s != nil {
+			if data, _, _, err := d.decodeStream(s); err == nil {
+				f.cmap, f.codeLen = parseCMap(data, f.codeLen)
+			}
+		}
+		fonts[name] = f
+	}
+	return fonts
+}
+
+// parseCMap reads the bfchar/bfrange sections of a ToUnicode CMap
+func parseCMap(data []byte, codeLen int) (map[int]string, int) {
+	m := map[int]string{}
+	l := &lexer{data: data}
+	var operands []interface{}
+
+	for {
+		tok, err := l.next()
+		if err != nil {
+			break
+		}
+		kw, ok := tok.(pdfKeyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if lo, ok := operands[0].(pdfString); ok && len(lo) > 0 {
+					codeLen = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, _ := operands[i].(pdfString)
+				dst, _ := operands[i+1].(pdfString)
+				m[codeOf(src)] = utf16BE(dst)
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, _ := operands[i].(pdfString)
+				hi, _ := operands[i+1].(pdfString)
+				a, b := codeOf(lo), codeOf(hi)
+				if b < a || b-a > 0xFFFF {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					base := append([]byte(nil), dst...)
+					for c := a; c <= b; c++ {
+						m[c] = utf16BE(base)
+						if len(base) > 0 {
+							base[len(base)-1]++
+						}
+					}
+				case pdfArray:
+					for c := a; c <= b && c-a < len(dst); c++ {
+						if s, ok := dst[c-a].(pdfString); ok {
+							m[c] = utf16BE(s)
+						}
+					}
+				}
+			}
+		}
+		operands = nil
+	}
+	if len(m) == 0 {
+		return nil, codeLen
+	}
+	return m, codeLen
+}
+
+func codeOf(b []byte) int {
+	code := 0
+	for _, c := range b {
+		code = code<<8 | int(c)
+	}
+	return code
+}
+
+func utf16BE(b []byte) string {
+	if len(b)%2 == 1 {
+		return winAnsi(b)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+type textWriter struct {
+	sb    strings.Builder
+	lastY float64
+	haveY bool
+}
+
+func (t *textWriter) write(s string) {
+	t.sb.WriteString(s)
+}
+
+func (t *textWriter) newline() {
+	str := t.sb.String()
+	if len(str) > 0 && !strings.HasSuffix(str, "\n") {
+		t.sb.WriteByte('\n')
+	}
+}
+
+func (t *textWriter) space() {
+	str := t.sb.String()
+	if len(str) > 0 && !strings.HasSuffix(str, " ") && !strings.HasSuffix(str, "\n") {
+		t.sb.WriteByte(' ')
+	}
+}
+
+func (d *pdfDoc) pageText(p pdfPage) string {
+	var content []byte
+	for _, c := range d.array(p.dict["Contents"]) {
+		s := d.stream(c)
+		if s == nil {
+			continue
+		}
+		if data, _, _, err := d.decodeStream(s); err == nil {
+			content = append(content, data...)
+			content = append(content, '\n')
+		}
+	}
+	t := &textWriter{}
+	d.contentText(content, p.resources, t, 0)
+	return strings.TrimSpace(t.sb.String())
+}
+
+func (d *pdfDoc) contentText(content []byte, res pdfDict, t *textWriter, depth int) {
+	fonts := d.loadFonts(res)
+	var font *pdfFont
+	var operands []interface{}
+	l := &lexer{data: content}
+
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return
+		}
+		kw, ok := tok.(pdfKeyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch kw {
+		case "BI":
+			skipInlineImage(l)
+		case "Tf":
+			if len(operands) >= 1 {
+				if n, ok := operands[0].(pdfName); ok {
+					font = fonts[string(n)]
+				}
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					t.write(font.decode(s))
+				}
+			}
+		case "'", "\"":
+			t.newline()
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					t.write(font.decode(s))
+				}
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				arr, _ := operands[len(operands)-1].(pdfArray)
+				for _, el := range arr {
+					switch v := el.(type) {
+					case pdfString:
+						t.write(font.decode(v))
+					case float64:
+						if v < -150 {
+							t.space()
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, _ := operands[1].(float64); ty != 0 {
+					t.newline()
+				} else {
+					t.space()
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				y, _ := operands[5].(float64)
+				if t.haveY && y != t.lastY {
+					t.newline()
+				} else if t.haveY {
+					t.space()
+				}
+				t.lastY, t.haveY = y, true
+			}
+		case "T*", "ET":
+			t.newline()
+		case "Do":
+			if depth < 3 && len(operands) >= 1 {
+				if n, ok := operands[0].(pdfName); ok {
+					if xs := d.stream(d.dict(res["XObject"])[string(n)]); xs != nil && xs.dict["Subtype"] == pdfName("Form") {
+						if data, _, _, err := d.decodeStream(xs); err == nil {
+							fres := d.dict(xs.dict["Resources"])
+							if fres == nil {
+								fres = res
+							}
+							d.contentText(data, fres, t, depth+1)
+						}
+					}
+				}
+			}
+		}
+		operands = nil
+	}
+}
+
+// skipInlineImage moves past "ID <binary> EI"
+func skipInlineImage(l *lexer) {
+	i := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if i < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += i + 2
+	for l.pos+2 <= len(l.data) {
+		j := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if j < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		at := l.pos + j
+		l.pos = at + 2
+		if at > 0 && isSpace(l.data[at-1]) && (l.pos == len(l.data) || isSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
+
+// ---------- Images ----------
+
+// pageImage returns the largest image XObject on a page, in a format an
+// OCR backend can read, along with a file extension.
+func (d *pdfDoc) pageImage(res pdfDict) ([]byte, string) {
+	var best *pdfStream
+	bestArea := 0
+	for _, ref := range d.dict(res["XObject"]) {
+		s := d.stream(ref)
+		if s == nil || s.dict["Subtype"] != pdfName("Image") {
+			continue
+		}
+		area := max(0, d.sizeOf(s.dict["Width"], 0, maxImageSide)) * max(0, d.sizeOf(s.dict["Height"], 0, maxImageSide))
+		if area > bestArea {
+			best, bestArea = s, area
+		}
+	}
+	if best == nil {
+		return nil, ""
+	}
+	return d.imageBytes(best)
+}
+
+func (d *pdfDoc) imageBytes(s *pdfStream) ([]byte, string) {
+	data, filter, parms, err := d.decodeStream(s)
+	if err != nil {
+		return nil, ""
+	}
+	w := d.sizeOf(s.dict["Width"], 0, maxImageSide)
+	h := d.sizeOf(s.dict["Height"], 0, maxImageSide)
+	if w < 0 || h < 0 {
+		return nil, ""
+	}
+
+	switch filter {
+	case "DCTDecode", "DCT":
+		return data, ".jpg"
+	case "JPXDecode":
+		return data, ".jp2"
+	case "CCITTFaxDecode", "CCF":
+		if parms == nil {
+			parms = pdfDict{}
+		}
+		return ccittTIFF(data, w, h, d.intOf(parms["K"], 0), parms["BlackIs1"] == true), ".tif"
+	case "":
+		img := d.rawImage(s, data, w, h)
+		if img == nil {
+			return nil, ""
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, ""
+		}
+		return buf.Bytes(), ".png"
+	}
+	return nil, ""
+}
+
+// rawImage builds an image from unfiltered gray, RGB or CMYK samples
+func (d *pdfDoc) rawImage(s *pdfStream, data []byte, w, h int) image.Image {
+	// w and h are at most maxImageSide, so w*h*4 cannot overflow
+	if w <= 0 || h <= 0 || w*h > maxImagePixels {
+		return nil
+	}
+	bpc := d.intOf(s.dict["BitsPerComponent"], 8)
+	comps := 0
+	switch cs := d.resolve(s.dict["ColorSpace"]).(type) {
+	case pdfName:
+		switch cs {
+		case "DeviceGray", "CalGray", "G":
+			comps = 1
+		case "DeviceRGB", "CalRGB", "RGB":
+			comps = 3
+		case "DeviceCMYK", "CMYK":
+			comps = 4
+		}
+	case pdfArray:
+		if len(cs) == 2 && cs[0] == pdfName("ICCBased") {
+			if icc := d.stream(cs[1]); icc != nil {
+				comps = d.sizeOf(icc.dict["N"], 0, 4)
+			}
+		}
+	}
+	if s.dict["ImageMask"] == true {
+		comps, bpc = 1, 1
+	}
+
+	switch {
+	case comps == 1 && bpc == 1:
+		stride := (w + 7) / 8
+		if len(data) < stride*h {
+			return nil
+		}
+		img := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if data[y*stride+x/8]&(0x80>>(x%8)) != 0 {
+					img.SetGray(x, y, color.Gray{Y: 255})
+				}
+			}
+		}
+		return img
+	case bpc != 8 || comps == 0 || len(data) < w*h*comps:
+		return nil
+	case comps == 1:
+		img := image.NewGray(image.Rect(0, 0, w, h))
+		copy(img.Pix, data)
+		return img
+	case comps == 3:
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for i := 0; i < w*h; i++ {
+			copy(img.Pix[i*4:], data[i*3:i*3+3])
+			img.Pix[i*4+3] = 255
+		}
+		return img
+	case comps == 4:
+		img := image.NewCMYK(image.Rect(0, 0, w, h))
+		copy(img.Pix, data)
+		return img
+	}
+	return nil
+}
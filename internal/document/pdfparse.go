@@ -0,0 +1,652 @@
+package document
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// A deliberately small PDF object reader: enough to walk the page tree,
+// decode content streams and pull out embedded images. It does not
+// use the xref table; objects are located by scanning for "N G obj".
+
+type pdfName string
+type pdfString []byte
+type pdfKeyword string
+type pdfArray []interface{}
+type pdfDict map[string]interface{}
+
+type pdfRef struct {
+	num, gen int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+type lexer struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+// Bounds on what a file may ask the parser to build
+const (
+	// maxNesting is how deeply arrays and dictionaries may nest
+	maxNesting = 256
+	// maxImageSide and maxImagePixels bound images and predictor rows
+	maxImageSide   = 1 << 16
+	maxImagePixels = 1 << 26
+	// defaultMaxDecoded caps a decoded stream when Limits.MaxBytes is unset
+	defaultMaxDecoded = 256 << 20
+)
+
+var errTooDeep = errors.New("PDF objects nest too deeply")
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isDelim(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isSpace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+func (l *lexer) regular() []byte {
+	start := l.pos
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	return l.data[start:l.pos]
+}
+
+// next returns the next object, or a pdfKeyword for operators and
+// unknown tokens. It returns io.EOF at the end of input.
+func (l *lexer) next() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		return pdfName(decodeName(l.regular())), nil
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			if l.depth >= maxNesting {
+				return nil, errTooDeep
+			}
+			l.pos += 2
+			l.depth++
+			defer func() { l.depth-- }()
+			return l.readDict()
+		}
+		return l.readHex(), nil
+	case c == '[':
+		if l.depth >= maxNesting {
+			return nil, errTooDeep
+		}
+		l.pos++
+		l.depth++
+		defer func() { l.depth-- }()
+		return l.readArray()
+	case c == '(':
+		return l.readLiteral(), nil
+	case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+		l.pos += 2
+		return pdfKeyword(">>"), nil
+	case isDelim(c):
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.readNumber(), nil
+	}
+
+	tok := l.regular()
+	if len(tok) == 0 {
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	}
+	switch string(tok) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfKeyword(tok), nil
+}
+
+func (l *lexer) readDict() (interface{}, error) {
+	d := pdfDict{}
+	for {
+		l.skipSpace()
+		if l.pos+1 < len(l.data) && l.data[l.pos] == '>' && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return d, nil
+		}
+		k, err := l.next()
+		if err != nil {
+			return d, err
+		}
+		key, ok := k.(pdfName)
+		if !ok {
+			continue
+		}
+		v, err := l.next()
+		if err != nil {
+			return d, err
+		}
+		d[string(key)] = v
+	}
+}
+
+func (l *lexer) readArray() (interface{}, error) {
+	var a pdfArray
+	for {
+		l.skipSpace()
+		if l.pos < len(l.data) && l.data[l.pos] == ']' {
+			l.pos++
+			return a, nil
+		}
+		v, err := l.next()
+		if err != nil {
+			return a, err
+		}
+		a = append(a, v)
+	}
+}
+
+func (l *lexer) readNumber() interface{} {
+	start := l.pos
+	for l.pos < len(l.data) && bytes.IndexByte([]byte("+-.0123456789"), l.data[l.pos]) >= 0 {
+		l.pos++
+	}
+	tok := string(l.data[start:l.pos])
+	f, err := strconv.ParseFloat(tok, 64)
+	if err != nil {
+		return pdfKeyword(tok)
+	}
+
+	// "N G R" is an indirect reference
+	if n, err := strconv.Atoi(tok); err == nil {
+		save := l.pos
+		l.skipSpace()
+		gstart := l.pos
+		for l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '9' {
+			l.pos++
+		}
+		if l.pos > gstart {
+			g, _ := strconv.Atoi(string(l.data[gstart:l.pos]))
+			l.skipSpace()
+			if l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+				(l.pos+1 == len(l.data) || isSpace(l.data[l.pos+1]) || isDelim(l.data[l.pos+1])) {
+				l.pos++
+				return pdfRef{num: n, gen: g}
+			}
+		}
+		l.pos = save
+	}
+	return f
+}
+
+func (l *lexer) readHex() pdfString {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if !isSpace(l.data[l.pos]) {
+			digits = append(digits, l.data[l.pos])
+		}
+		l.pos++
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	n, _ := hex.Decode(out, digits)
+	return pdfString(out[:n])
+}
+
+func (l *lexer) readLiteral() pdfString {
+	l.pos++
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func decodeName(b []byte) string {
+	if bytes.IndexByte(b, '#') < 0 {
+		return string(b)
+	}
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i+2 < len(b) {
+			if v, err := strconv.ParseUint(string(b[i+1:i+3]), 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
+
+// ---------- Document objects ----------
+
+type pdfDoc struct {
+	objs    map[int]interface{}
+	trailer pdfDict
+	// maxDecoded caps the size of each decoded stream
+	maxDecoded int64
+}
+
+var objHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+func parsePDF(data []byte, maxDecoded int64) (*pdfDoc, error) {
+	if maxDecoded <= 0 {
+		maxDecoded = defaultMaxDecoded
+	}
+	d := &pdfDoc{objs: map[int]interface{}{}, trailer: pdfDict{}, maxDecoded: maxDecoded}
+
+	pos := 0
+	for pos < len(data) {
+		loc := objHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		l := &lexer{data: data, pos: pos + loc[1]}
+		v, err := l.next()
+		if err != nil {
+			break
+		}
+		if dict, ok := v.(pdfDict); ok {
+			save := l.pos
+			l.skipSpace()
+			if bytes.HasPrefix(data[l.pos:], []byte("stream")) {
+				l.pos += len("stream")
+				if l.pos < len(data) && data[l.pos] == '\r' {
+					l.pos++
+				}
+				if l.pos < len(data) && data[l.pos] == '\n' {
+					l.pos++
+				}
+				raw, end := streamBody(data, l.pos, dict)
+				v = &pdfStream{dict: dict, raw: raw}
+				l.pos = end
+			} else {
+				l.pos = save
+			}
+		}
+		d.objs[num] = v
+		pos = l.pos
+	}
+
+	if len(d.objs) == 0 {
+		return nil, fmt.Errorf("no PDF objects found")
+	}
+
+	// Trailer: classic "trailer" dictionaries, or the dictionary of an XRef stream
+	if i := bytes.LastIndex(data, []byte("trailer")); i >= 0 {
+		l := &lexer{data: data, pos: i + len("trailer")}
+		if v, err := l.next(); err == nil {
+			if t, ok := v.(pdfDict); ok {
+				d.trailer = t
+			}
+		}
+	}
+	if d.trailer["Root"] == nil {
+		for _, num := range d.sortedNums() {
+			if s, ok := d.objs[num].(*pdfStream); ok && s.dict["Type"] == pdfName("XRef") && s.dict["Root"] != nil {
+				d.trailer = s.dict
+			}
+		}
+	}
+
+	d.expandObjectStreams()
+	return d, nil
+}
+
+// streamBody returns the stream data starting at start and the offset after "endstream"
+func streamBody(data []byte, start int, dict pdfDict) ([]byte, int) {
+	if n, ok := dict["Length"].(float64); ok {
+		end := start + int(n)
+		if end <= len(data) && end >= start {
+			rest := bytes.TrimLeft(data[end:min(end+16, len(data))], "\r\n \t")
+			if bytes.HasPrefix(rest, []byte("endstream")) {
+				return data[start:end], end + bytes.Index(data[end:], []byte("endstream")) + len("endstream")
+			}
+		}
+	}
+	i := bytes.Index(data[start:], []byte("endstream"))
+	if i < 0 {
+		return data[start:], len(data)
+	}
+	raw := data[start : start+i]
+	raw = bytes.TrimSuffix(raw, []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	return raw, start + i + len("endstream")
+}
+
+func (d *pdfDoc) sortedNums() []int {
+	nums := make([]int, 0, len(d.objs))
+	for n := range d.objs {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// expandObjectStreams unpacks objects stored inside /Type /ObjStm streams
+func (d *pdfDoc) expandObjectStreams() {
+	for _, num := range d.sortedNums() {
+		s, ok := d.objs[num].(*pdfStream)
+		if !ok || s.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		data, _, _, err := d.decodeStream(s)
+		if err != nil {
+			continue
+		}
+		n := d.sizeOf(s.dict["N"], 0, len(data))
+		first := d.sizeOf(s.dict["First"], 0, len(data))
+		if n < 0 || first < 0 {
+			continue
+		}
+		hl := &lexer{data: data[:first]}
+		for i := 0; i < n; i++ {
+			on, err1 := hl.next()
+			off, err2 := hl.next()
+			if err1 != nil || err2 != nil {
+				break
+			}
+			onum, _ := on.(float64)
+			ooff, _ := off.(float64)
+			if ooff < 0 || ooff >= float64(len(data)-first) {
+				continue
+			}
+			if _, exists := d.objs[int(onum)]; exists {
+				continue
+			}
+			l := &lexer{data: data, pos: first + int(ooff)}
+			if v, err := l.next(); err == nil {
+				d.objs[int(onum)] = v
+			}
+		}
+	}
+}
+
+func (d *pdfDoc) resolve(v interface{}) interface{} {
+	for i := 0; i < 16; i++ {
+		r, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = d.objs[r.num]
+	}
+	return nil
+}
+
+func (d *pdfDoc) dict(v interface{}) pdfDict {
+	switch t := d.resolve(v).(type) {
+	case pdfDict:
+		return t
+	case *pdfStream:
+		return t.dict
+	}
+	return nil
+}
+
+func (d *pdfDoc) array(v interface{}) pdfArray {
+	switch t := d.resolve(v).(type) {
+	case pdfArray:
+		return t
+	case nil:
+		return nil
+	default:
+		return pdfArray{t}
+	}
+}
+
+func (d *pdfDoc) intOf(v interface{}, def int) int {
+	if f, ok := d.resolve(v).(float64); ok {
+		return int(f)
+	}
+	return def
+}
+
+// sizeOf reads a size, count or offset: def when v is not a number, -1
+// when it is negative or above limit
+func (d *pdfDoc) sizeOf(v interface{}, def, limit int) int {
+	f, ok := d.resolve(v).(float64)
+	if !ok {
+		return def
+	}
+	if !(f >= 0 && f <= float64(limit)) {
+		return -1
+	}
+	return int(f)
+}
+
+func (d *pdfDoc) stream(v interface{}) *pdfStream {
+	s, _ := d.resolve(v).(*pdfStream)
+	return s
+}
+
+// decodeStream applies the stream's filters. It stops at the first filter
+// it cannot (or should not) decode, such as DCTDecode, and returns its
+// name and decode parameters so the caller can deal with image data.
+func (d *pdfDoc) decodeStream(s *pdfStream) ([]byte, string, pdfDict, error) {
+	filters := d.array(s.dict["Filter"])
+	parms := d.array(s.dict["DecodeParms"])
+	data := s.raw
+
+	for i, f := range filters {
+		name, _ := d.resolve(f).(pdfName)
+		var p pdfDict
+		if i < len(parms) {
+			p = d.dict(parms[i])
+		}
+
+		var err error
+		switch name {
+		case "FlateDecode", "Fl":
+			data, err = inflate(data, d.maxDecoded)
+			if err == nil {
+				data, err = unpredict(data, d, p)
+			}
+		case "ASCIIHexDecode", "AHx":
+			data = (&lexer{data: append(append([]byte{'<'}, data...), '>')}).readHex()
+		case "ASCII85Decode", "A85":
+			data, err = decodeASCII85(data)
+		default:
+			return data, string(name), p, nil
+		}
+		if err != nil {
+			return nil, string(name), p, err
+		}
+	}
+	return data, "", nil, nil
+}
+
+// inflate decompresses at most limit bytes; a stream that inflates past
+// that is rejected rather than cut short
+func inflate(data []byte, limit int64) ([]byte, error) {
+	var r io.ReadCloser
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		if len(data) < 2 {
+			return nil, err
+		}
+		// some writers emit raw deflate without the zlib header
+		r = flate.NewReader(bytes.NewReader(data))
+	} else {
+		r = zr
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if int64(len(out)) > limit {
+		return nil, fmt.Errorf("stream inflates past %d bytes", limit)
+	}
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	var clean []byte
+	for _, c := range data {
+		if !isSpace(c) {
+			clean = append(clean, c)
+		}
+	}
+	clean = bytes.TrimPrefix(clean, []byte("<~"))
+	if i := bytes.Index(clean, []byte("~>")); i >= 0 {
+		clean = clean[:i]
+	}
+	out := make([]byte, len(clean)*4/5+4)
+	n, _, err := ascii85.Decode(out, clean, true)
+	return out[:n], err
+}
+
+// unpredict reverses PNG predictors (Predictor >= 10)
+func unpredict(data []byte, d *pdfDoc, p pdfDict) ([]byte, error) {
+	if p == nil || d.intOf(p["Predictor"], 1) < 10 {
+		return data, nil
+	}
+	colors := d.sizeOf(p["Colors"], 1, 32)
+	bpc := d.sizeOf(p["BitsPerComponent"], 8, 16)
+	cols := d.sizeOf(p["Columns"], 1, maxImageSide)
+	if colors < 1 || bpc < 1 || cols < 1 {
+		return nil, fmt.Errorf("invalid predictor parameters")
+	}
+	bpp := max(1, (colors*bpc+7)/8)
+	rowLen := (colors*bpc*cols + 7) / 8
+
+	var out []byte
+	prev := make([]byte, rowLen)
+	for i := 0; i+rowLen+1 <= len(data); i += rowLen + 1 {
+		ft := data[i]
+		row := append([]byte(nil), data[i+1:i+1+rowLen]...)
+		for j := range row {
+			var left, upLeft byte
+			if j >= bpp {
+				left = row[j-bpp]
+				upLeft = prev[j-bpp]
+			}
+			up := prev[j]
+			switch ft {
+			case 1:
+				row[j] += left
+			case 2:
+				row[j] += up
+			case 3:
+				row[j] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[j] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,239 @@
+package document
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	tagImageWidth      = 256
+	tagImageLength     = 257
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagPhotometric     = 262
+	tagStripOffsets    = 273
+	tagRowsPerStrip    = 278
+	tagStripByteCounts = 279
+	tagTileOffsets     = 324
+	tagTileByteCounts  = 325
+)
+
+const (
+	tiffShort = 3
+	tiffLong  = 4
+)
+
+var tiffTypeSize = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// splitTIFFPages returns each IFD of a (multi-page) TIFF as its own single-page TIFF
+func splitTIFFPages(data []byte, maxPages int) ([]Page, int, error) {
+	if len(data) < 8 {
+		return nil, 0, fmt.Errorf("truncated TIFF")
+	}
+	var bo binary.ByteOrder = binary.LittleEndian
+	if data[0] == 'M' {
+		bo = binary.BigEndian
+	}
+
+	var pages []Page
+	total := 0
+	seen := map[uint32]bool{}
+	for off := bo.Uint32(data[4:8]); off != 0 && !seen[off]; {
+		seen[off] = true
+		entries, next, err := readIFD(data, off, bo)
+		if err != nil {
+			return nil, 0, err
+		}
+		total++
+		if maxPages <= 0 || len(pages) < maxPages {
+			page, err := rebuildPage(data, entries, bo)
+			if err != nil {
+				return nil, 0, fmt.Errorf("page %d: %v", total, err)
+			}
+			pages = append(pages, Page{
+				Number:    total,
+				Image:     page,
+				ImageName: fmt.Sprintf("page-%d.tif", total),
+			})
+		}
+		off = next
+	}
+	if total == 0 {
+		return nil, 0, fmt.Errorf("no pages found in TIFF")
+	}
+	return pages, total, nil
+}
+
+func readIFD(data []byte, off uint32, bo binary.ByteOrder) ([]tiffEntry, uint32, error) {
+	if int(off)+2 > len(data) {
+		return nil, 0, fmt.Errorf("IFD offset out of range")
+	}
+	n := int(bo.Uint16(data[off:]))
+	base := int(off) + 2
+	if base+n*12+4 > len(data) {
+		return nil, 0, fmt.Errorf("IFD out of range")
+	}
+
+	entries := make([]tiffEntry, 0, n)
+	for i := 0; i < n; i++ {
+		e := data[base+i*12:]
+		en := tiffEntry{tag: bo.Uint16(e), typ: bo.Uint16(e[2:]), count: bo.Uint32(e[4:])}
+		size := tiffTypeSize[en.typ] * int(en.count)
+		if size <= 4 {
+			en.value = append([]byte(nil), e[8:8+size]...)
+		} else {
+			vo := int(bo.Uint32(e[8:]))
+			if vo+size > len(data) || vo < 0 {
+				return nil, 0, fmt.Errorf("tag %d value out of range", en.tag)
+			}
+			en.value = append([]byte(nil), data[vo:vo+size]...)
+		}
+		entries = append(entries, en)
+	}
+	return entries, bo.Uint32(data[base+n*12:]), nil
+}
+
+// entryInts reads a SHORT or LONG entry; other types yield nothing
+func entryInts(e tiffEntry, bo binary.ByteOrder) []uint32 {
+	var out []uint32
+	switch e.typ {
+	case tiffShort:
+		for i := 0; i+2 <= len(e.value); i += 2 {
+			out = append(out, uint32(bo.Uint16(e.value[i:])))
+		}
+	case tiffLong:
+		for i := 0; i+4 <= len(e.value); i += 4 {
+			out = append(out, bo.Uint32(e.value[i:]))
+		}
+	}
+	return out
+}
+
+// rebuildPage copies one IFD and the strips or tiles it points to into a new file
+func rebuildPage(data []byte, entries []tiffEntry, bo binary.ByteOrder) ([]byte, error) {
+	var offsets, counts []uint32
+	offTag := uint16(tagStripOffsets)
+	for _, e := range entries {
+		switch e.tag {
+		case tagStripOffsets, tagTileOffsets:
+			offsets, offTag = entryInts(e, bo), e.tag
+		case tagStripByteCounts, tagTileByteCounts:
+			counts = entryInts(e, bo)
+		}
+	}
+	if len(offsets) == 0 || len(offsets) != len(counts) {
+		return nil, fmt.Errorf("missing strip offsets")
+	}
+
+	var chunks [][]byte
+	for i, o := range offsets {
+		end := int(o) + int(counts[i])
+		if end > len(data) || end < int(o) {
+			return nil, fmt.Errorf("strip out of range")
+		}
+		chunks = append(chunks, data[o:end])
+	}
+	return buildTIFF(entries, offTag, chunks, bo), nil
+}
+
+// buildTIFF writes a single-IFD TIFF; the offsets tag is rewritten to point at chunks
+func buildTIFF(entries []tiffEntry, offTag uint16, chunks [][]byte, bo binary.ByteOrder) []byte {
+	ifdSize := 2 + len(entries)*12 + 4
+	extra := 0
+	for _, e := range entries {
+		size := len(e.value)
+		if e.tag == offTag {
+			size = 4 * len(chunks)
+		}
+		if size > 4 {
+			extra += size + size%2
+		}
+	}
+
+	var buf bytes.Buffer
+	if bo == binary.BigEndian {
+		buf.WriteString("MM\x00*")
+	} else {
+		buf.WriteString("II*\x00")
+	}
+	binary.Write(&buf, bo, uint32(8))
+
+	chunkPos := uint32(8 + ifdSize + extra)
+	chunkOffsets := make([]byte, 4*len(chunks))
+	for i, c := range chunks {
+		bo.PutUint32(chunkOffsets[i*4:], chunkPos)
+		chunkPos += uint32(len(c))
+	}
+
+	var values bytes.Buffer
+	valuePos := uint32(8 + ifdSize)
+	binary.Write(&buf, bo, uint16(len(entries)))
+	for _, e := range entries {
+		if e.tag == offTag {
+			e.typ, e.count, e.value = tiffLong, uint32(len(chunks)), chunkOffsets
+		}
+		binary.Write(&buf, bo, e.tag)
+		binary.Write(&buf, bo, e.typ)
+		binary.Write(&buf, bo, e.count)
+		if len(e.value) <= 4 {
+			v := make([]byte, 4)
+			copy(v, e.value)
+			buf.Write(v)
+			continue
+		}
+		binary.Write(&buf, bo, valuePos+uint32(values.Len()))
+		values.Write(e.value)
+		if len(e.value)%2 == 1 {
+			values.WriteByte(0)
+		}
+	}
+	binary.Write(&buf, bo, uint32(0))
+	buf.Write(values.Bytes())
+	for _, c := range chunks {
+		buf.Write(c)
+	}
+	return buf.Bytes()
+}
+
+// ccittTIFF wraps a PDF CCITTFaxDecode stream in a TIFF container so OCR
+// backends can read scanned black and white pages.
+func ccittTIFF(data []byte, w, h, k int, blackIs1 bool) []byte {
+	bo := binary.LittleEndian
+	short := func(tag uint16, v uint16) tiffEntry {
+		return tiffEntry{tag: tag, typ: tiffShort, count: 1, value: bo.AppendUint16(nil, v)}
+	}
+	long := func(tag uint16, v uint32) tiffEntry {
+		return tiffEntry{tag: tag, typ: tiffLong, count: 1, value: bo.AppendUint32(nil, v)}
+	}
+
+	compression := uint16(4) // Group 4
+	if k >= 0 {
+		compression = 3
+	}
+	photometric := uint16(1)
+	if blackIs1 {
+		photometric = 0
+	}
+	entries := []tiffEntry{
+		long(tagImageWidth, uint32(w)),
+		long(tagImageLength, uint32(h)),
+		short(tagBitsPerSample, 1),
+		short(tagCompression, compression),
+		short(tagPhotometric, photometric),
+		long(tagStripOffsets, 0),
+		long(tagRowsPerStrip, uint32(h)),
+		long(tagStripByteCounts, uint32(len(data))),
+	}
+	if k > 0 {
+		entries = append(entries, long(292, 1)) // T4Options: 2D coding
+	}
+	return buildTIFF(entries, tagStripOffsets, [][]byte{data}, bo)
+}
@@ -0,0 +1,218 @@
+// Package fetch downloads user-supplied URLs without letting them reach
+// internal services: private, loopback and link-local addresses are refused
+// at dial time (after DNS resolution), and bodies are size and type checked.
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrBlockedAddress = errors.New("destination address is not allowed")
+	ErrTooLarge       = errors.New("response body exceeds size limit")
+	ErrContentType    = errors.New("unsupported content type")
+)
+
+type Config struct {
+	Timeout      time.Duration
+	MaxBytes     int64
+	MaxRedirects int
+	// Allow lists prefixes that are reachable even though they would be
+	// denied by default (e.g. an internal image store).
+	Allow []netip.Prefix
+}
+
+type Fetcher struct {
+	cfg    Config
+	client *http.Client
+}
+
+// Ranges refused unless explicitly allowed, on top of what netip classifies
+// as private, loopback, link-local, multicast or unspecified.
+var deniedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+func New(cfg Config) *Fetcher {
+	f := &Fetcher{cfg: cfg}
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: f.control,
+	}
+	f.client = &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			// no proxy: the dial-time check must see the real destination
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: cfg.Timeout,
+			MaxIdleConns:          16,
+			IdleConnTimeout:       60 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", cfg.MaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+	return f
+}
+
+// ParseAllowList reads a comma-separated list of CIDRs or single IPs
+func ParseAllowList(v string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if p, err := netip.ParsePrefix(item); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow-list entry %q", item)
+		}
+		out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return out, nil
+}
+
+// control runs after DNS resolution for every connection, including
+// redirects, so a hostname that re-resolves to an internal IP is still refused.
+func (f *Fetcher) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !f.Allowed(addr) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	return nil
+}
+
+// Allowed reports whether addr may be dialled
+func (f *Fetcher) Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range f.cfg.Allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, p := range deniedPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Fetch downloads rawURL and returns the body and its sniffed content type,
+// which must start with one of the accept prefixes (e.g. "image/").
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string, accept []string) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, "", fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, "", fmt.Errorf("fetch failed: HTTP %d", resp.StatusCode)
+	}
+	if f.cfg.MaxBytes > 0 && resp.ContentLength > f.cfg.MaxBytes {
+		return nil, "", ErrTooLarge
+	}
+
+	body := io.Reader(resp.Body)
+	if f.cfg.MaxBytes > 0 {
+		body = io.LimitReader(resp.Body, f.cfg.MaxBytes+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", err
+	}
+	if f.cfg.MaxBytes > 0 && int64(len(data)) > f.cfg.MaxBytes {
+		return nil, "", ErrTooLarge
+	}
+
+	ct, err := CheckType(data, accept)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, ct, nil
+}
+
+// CheckType sniffs data and verifies it against the accept prefixes.
+// The Content-Type header is never trusted.
+func CheckType(data []byte, accept []string) (string, error) {
+	ct := Sniff(data)
+	if len(accept) == 0 {
+		return ct, nil
+	}
+	for _, a := range accept {
+		if strings.HasPrefix(ct, a) {
+			return ct, nil
+		}
+	}
+	return ct, fmt.Errorf("%w: %s", ErrContentType, ct)
+}
+
+// Sniff is http.DetectContentType plus formats it does not know about
+func Sniff(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return "image/tiff"
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" &&
+		(string(data[8:12]) == "heic" || string(data[8:12]) == "avif"):
+		return "image/" + string(data[8:12])
+	}
+	ct := http.DetectContentType(data)
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return ct
+}
@@ -0,0 +1,204 @@
+// Package files stores uploaded files on local disk, each next to a JSON
+// document with its metadata, in the shape of OpenAI's file objects.
+package files
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+// File is the metadata of a stored file
+type File struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+	// Owner identifies who may see the file; it is stored but never sent
+	// to clients
+	Owner string `json:"-"`
+}
+
+// stored is the metadata document on disk
+type stored struct {
+	*File
+	Owner string `json:"owner,omitempty"`
+}
+
+var validID = regexp.MustCompile(`^file-[0-9a-f]{24}$`)
+
+type Store struct {
+	dir string
+}
+
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Create stores the contents of r under a new ID, owned by owner
+func (s *Store) Create(filename, purpose, owner string, r io.Reader) (*File, error) {
+	f := &File{
+		ID:        "file-" + randomHex(12),
+		Object:    "file",
+		CreatedAt: time.Now().Unix(),
+		Filename:  filepath.Base(filename),
+		Purpose:   purpose,
+		Owner:     owner,
+	}
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Bytes = n
+	if err := os.Rename(tmp.Name(), s.path(f.ID)); err != nil {
+		return nil, err
+	}
+	meta, _ := json.Marshal(stored{File: f, Owner: owner})
+	if err := writeFile(s.path(f.ID)+".json", meta); err != nil {
+		os.Remove(s.path(f.ID))
+		return nil, err
+	}
+	return f, nil
+}
+
+// Get returns a file's metadata
+func (s *Store) Get(id string) (*File, error) {
+	if !validID.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	f, err := load(s.path(id) + ".json")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// load reads a metadata document
+func load(name string) (*File, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	rec := stored{File: &File{}}
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, err
+	}
+	rec.File.Owner = rec.Owner
+	return rec.File, nil
+}
+
+// Open returns a file's metadata and a reader for its contents
+func (s *Store) Open(id string) (*File, io.ReadCloser, error) {
+	f, err := s.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	rc, err := os.Open(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, rc, nil
+}
+
+// List returns up to limit files (0 = all) of owner with the given purpose
+// (any if empty), newest first unless ascending, after the file with ID
+// after (if set), and whether there are more
+func (s *Store) List(owner, purpose, after string, limit int, ascending bool) ([]*File, bool, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "file-*.json"))
+	if err != nil {
+		return nil, false, err
+	}
+	var all []*File
+	for _, p := range paths {
+		f, err := load(p)
+		if err != nil || f.Owner != owner || (purpose != "" && f.Purpose != purpose) {
+			continue
+		}
+		all = append(all, f)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if ascending {
+			a, b = b, a
+		}
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt > b.CreatedAt
+		}
+		return a.ID > b.ID
+	})
+	if after != "" {
+		for i, f := range all {
+			if f.ID == after {
+				all = all[i+1:]
+				break
+			}
+		}
+	}
+	if limit > 0 && len(all) > limit {
+		return all[:limit], true, nil
+	}
+	return all, false, nil
+}
+
+// Delete removes a file and its metadata
+func (s *Store) Delete(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(id) + ".json"); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// IsID reports whether s looks like a file ID
+func IsID(s string) bool {
+	return validID.MatchString(s)
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+// writeFile replaces name atomically
+func writeFile(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
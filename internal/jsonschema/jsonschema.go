@@ -0,0 +1,524 @@
+// Package jsonschema validates decoded JSON against the subset of JSON Schema
+// that structured-output schemas use: type, properties, required,
+// additionalProperties, items, enum, const, numeric and length bounds,
+// pattern, allOf/anyOf/oneOf, not and local $ref (#/$defs, #/definitions).
+// Unknown keywords (format, description, ...) are ignored.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error describes the first mismatch found, with a JSON-pointer-like path
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks doc (as produced by json.Unmarshal into interface{})
+// against schema. schema may be a map or any JSON-marshalable value.
+func Validate(schema, doc interface{}) error {
+	root, err := normalize(schema)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	v := validator{root: root, active: map[string]bool{}}
+	return v.validate(root, doc, "")
+}
+
+// Check reports a schema Validate cannot use: one with a $ref that does not
+// resolve, or with $refs that lead back to themselves without descending
+// into the document (such as {"$ref": "#"}), which would never finish
+func Check(schema interface{}) error {
+	root, err := normalize(schema)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	v := validator{root: root}
+	c := refChecker{v: &v, stack: map[string]bool{}, done: map[string]bool{}}
+	return c.walk(root, "#", 0)
+}
+
+// ValidateJSON parses data and validates it
+func ValidateJSON(schema interface{}, data []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return &Error{Message: "not valid JSON: " + err.Error()}
+	}
+	return Validate(schema, doc)
+}
+
+// normalize round-trips the schema through JSON so it is made of plain maps,
+// slices, float64, string and bool
+func normalize(schema interface{}) (interface{}, error) {
+	if schema == nil {
+		return map[string]interface{}{}, nil
+	}
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// maxDepth bounds how deeply schemas may nest, counting $ref hops
+const maxDepth = 512
+
+type validator struct {
+	root interface{}
+	// active holds the $refs being followed, keyed by ref and document
+	// path; meeting one again means the schema loops on the same value
+	active map[string]bool
+	depth  int
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) error {
+	return &Error{Path: path, Message: fmt.Sprintf(format, args...)}
+}
+
+func (v *validator) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("only local $ref is supported: %s", ref)
+	}
+	node := v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %s", ref)
+		}
+		if node, ok = m[part]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref %s", ref)
+		}
+	}
+	return node, nil
+}
+
+func (v *validator) validate(schema, doc interface{}, path string) error {
+	if v.depth >= maxDepth {
+		return v.fail(path, "schema nests more than %d levels deep", maxDepth)
+	}
+	v.depth++
+	defer func() { v.depth-- }()
+
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			return v.fail(path, "no value is allowed here")
+		}
+		return nil
+	case map[string]interface{}:
+		return v.validateObject(s, doc, path)
+	}
+	return nil
+}
+
+func (v *validator) validateObject(s map[string]interface{}, doc interface{}, path string) error {
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := v.resolve(ref)
+		if err != nil {
+			return v.fail(path, "%v", err)
+		}
+		key := ref + "\x00" + path
+		if v.active[key] {
+			return v.fail(path, "$ref %s loops without consuming the value", ref)
+		}
+		v.active[key] = true
+		err = v.validate(target, doc, path)
+		delete(v.active, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	if t, ok := s["type"]; ok {
+		if err := v.checkType(t, doc, path); err != nil {
+			return err
+		}
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if equal(e, doc) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return v.fail(path, "value %s is not one of %s", compact(doc), compact(enum))
+		}
+	}
+	if c, ok := s["const"]; ok && !equal(c, doc) {
+		return v.fail(path, "value must be %s", compact(c))
+	}
+
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		if err := v.checkProperties(s, d, path); err != nil {
+			return err
+		}
+	case []interface{}:
+		if err := v.checkItems(s, d, path); err != nil {
+			return err
+		}
+	case string:
+		if err := v.checkString(s, d, path); err != nil {
+			return err
+		}
+	case float64:
+		if err := v.checkNumber(s, d, path); err != nil {
+			return err
+		}
+	}
+
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if err := v.validate(sub, doc, path); err != nil {
+				return err
+			}
+		}
+	}
+	if alts, ok := s["anyOf"].([]interface{}); ok {
+		var firstErr error
+		matched := false
+		for _, sub := range alts {
+			err := v.validate(sub, doc, path)
+			if err == nil {
+				matched = true
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if !matched {
+			return v.fail(path, "does not match any of the allowed schemas (first mismatch: %v)", firstErr)
+		}
+	}
+	if one, ok := s["oneOf"].([]interface{}); ok {
+		n := 0
+		for _, sub := range one {
+			if v.validate(sub, doc, path) == nil {
+				n++
+			}
+		}
+		if n != 1 {
+			return v.fail(path, "must match exactly one schema in oneOf, matched %d", n)
+		}
+	}
+	if not, ok := s["not"]; ok {
+		if v.validate(not, doc, path) == nil {
+			return v.fail(path, "must not match the schema in not")
+		}
+	}
+	return nil
+}
+
+// refChecker walks every subschema, resolving each $ref and following the
+// ones applied to the same value ($ref, allOf, anyOf, oneOf, not) to find
+// loops
+type refChecker struct {
+	v *validator
+	// stack holds the $refs on the current same-value chain, done the ones
+	// already shown to be loop-free
+	stack, done map[string]bool
+}
+
+// sameValue lists the subschemas of s applied to the value s itself
+// applies to
+func sameValue(s map[string]interface{}, ptr string) ([]interface{}, []string) {
+	var subs []interface{}
+	var ptrs []string
+	for _, k := range []string{"allOf", "anyOf", "oneOf"} {
+		list, _ := s[k].([]interface{})
+		for i, sub := range list {
+			subs = append(subs, sub)
+			ptrs = append(ptrs, fmt.Sprintf("%s/%s/%d", ptr, k, i))
+		}
+	}
+	if not, ok := s["not"]; ok {
+		subs = append(subs, not)
+		ptrs = append(ptrs, ptr+"/not")
+	}
+	return subs, ptrs
+}
+
+// walk checks node and every schema nested in it
+func (c *refChecker) walk(node interface{}, ptr string, depth int) error {
+	s, ok := node.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if depth >= maxDepth {
+		return fmt.Errorf("%s: schema nests more than %d levels deep", ptr, maxDepth)
+	}
+	if err := c.follow(s, ptr, 0); err != nil {
+		return err
+	}
+
+	var children []interface{}
+	var ptrs []string
+	add := func(sub interface{}, p string) {
+		children = append(children, sub)
+		ptrs = append(ptrs, p)
+	}
+	for _, k := range []string{"properties", "$defs", "definitions"} {
+		m, _ := s[k].(map[string]interface{})
+		keys := make([]string, 0, len(m))
+		for name := range m {
+			keys = append(keys, name)
+		}
+		sort.Strings(keys)
+		for _, name := range keys {
+			add(m[name], ptr+"/"+k+"/"+name)
+		}
+	}
+	for _, k := range []string{"allOf", "anyOf", "oneOf", "prefixItems"} {
+		list, _ := s[k].([]interface{})
+		for i, sub := range list {
+			add(sub, fmt.Sprintf("%s/%s/%d", ptr, k, i))
+		}
+	}
+	for _, k := range []string{"items", "additionalProperties", "not"} {
+		if sub, ok := s[k]; ok {
+			add(sub, ptr+"/"+k)
+		}
+	}
+	for i, sub := range children {
+		if err := c.walk(sub, ptrs[i], depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// follow resolves the $ref of s and those reached from it on the same
+// value, failing on one that leads back to itself
+func (c *refChecker) follow(s map[string]interface{}, ptr string, depth int) error {
+	if depth >= maxDepth {
+		return fmt.Errorf("%s: $refs nest more than %d levels deep", ptr, maxDepth)
+	}
+	if ref, ok := s["$ref"].(string); ok && !c.done[ref] {
+		if c.stack[ref] {
+			return fmt.Errorf("%s: $ref %s refers back to itself", ptr, ref)
+		}
+		target, err := c.v.resolve(ref)
+		if err != nil {
+			return fmt.Errorf("%s: %v", ptr, err)
+		}
+		if t, ok := target.(map[string]interface{}); ok {
+			c.stack[ref] = true
+			err := c.follow(t, ref, depth+1)
+			delete(c.stack, ref)
+			if err != nil {
+				return err
+			}
+		}
+		c.done[ref] = true
+	}
+	subs, ptrs := sameValue(s, ptr)
+	for i, sub := range subs {
+		if m, ok := sub.(map[string]interface{}); ok {
+			if err := c.follow(m, ptrs[i], depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func typeOf(doc interface{}) string {
+	switch d := doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if d == math.Trunc(d) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", doc)
+}
+
+func (v *validator) checkType(t, doc interface{}, path string) error {
+	var allowed []string
+	switch tt := t.(type) {
+	case string:
+		allowed = []string{tt}
+	case []interface{}:
+		for _, x := range tt {
+			if s, ok := x.(string); ok {
+				allowed = append(allowed, s)
+			}
+		}
+	}
+	actual := typeOf(doc)
+	for _, a := range allowed {
+		if a == actual || (a == "number" && actual == "integer") {
+			return nil
+		}
+	}
+	return v.fail(path, "expected %s, got %s", strings.Join(allowed, " or "), actual)
+}
+
+func (v *validator) checkProperties(s map[string]interface{}, d map[string]interface{}, path string) error {
+	if req, ok := s["required"].([]interface{}); ok {
+		for _, r := range req {
+			name, _ := r.(string)
+			if _, ok := d[name]; !ok {
+				return v.fail(path, "missing required property %q", name)
+			}
+		}
+	}
+
+	props, _ := s["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := path + "/" + k
+		if sub, ok := props[k]; ok {
+			if err := v.validate(sub, d[k], child); err != nil {
+				return err
+			}
+			continue
+		}
+		switch ap := s["additionalProperties"].(type) {
+		case bool:
+			if !ap {
+				return v.fail(path, "unexpected property %q", k)
+			}
+		case map[string]interface{}:
+			if err := v.validate(ap, d[k], child); err != nil {
+				return err
+			}
+		}
+	}
+
+	if n, ok := s["minProperties"].(float64); ok && float64(len(d)) < n {
+		return v.fail(path, "must have at least %v properties", n)
+	}
+	if n, ok := s["maxProperties"].(float64); ok && float64(len(d)) > n {
+		return v.fail(path, "must have at most %v properties", n)
+	}
+	return nil
+}
+
+func (v *validator) checkItems(s map[string]interface{}, d []interface{}, path string) error {
+	start := 0
+	if prefix, ok := s["prefixItems"].([]interface{}); ok {
+		for i, sub := range prefix {
+			if i >= len(d) {
+				break
+			}
+			if err := v.validate(sub, d[i], fmt.Sprintf("%s/%d", path, i)); err != nil {
+				return err
+			}
+		}
+		start = len(prefix)
+	}
+	if items, ok := s["items"]; ok {
+		for i := start; i < len(d); i++ {
+			if err := v.validate(items, d[i], fmt.Sprintf("%s/%d", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	if n, ok := s["minItems"].(float64); ok && float64(len(d)) < n {
+		return v.fail(path, "must have at least %v items, has %d", n, len(d))
+	}
+	if n, ok := s["maxItems"].(float64); ok && float64(len(d)) > n {
+		return v.fail(path, "must have at most %v items, has %d", n, len(d))
+	}
+	if u, ok := s["uniqueItems"].(bool); ok && u {
+		for i := range d {
+			for j := i + 1; j < len(d); j++ {
+				if equal(d[i], d[j]) {
+					return v.fail(path, "items %d and %d are equal", i, j)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (v *validator) checkString(s map[string]interface{}, d string, path string) error {
+	n := float64(utf8.RuneCountInString(d))
+	if m, ok := s["minLength"].(float64); ok && n < m {
+		return v.fail(path, "must be at least %v characters", m)
+	}
+	if m, ok := s["maxLength"].(float64); ok && n > m {
+		return v.fail(path, "must be at most %v characters", m)
+	}
+	if p, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return v.fail(path, "invalid pattern %q in schema", p)
+		}
+		if !re.MatchString(d) {
+			return v.fail(path, "%q does not match pattern %q", d, p)
+		}
+	}
+	return nil
+}
+
+func (v *validator) checkNumber(s map[string]interface{}, d float64, path string) error {
+	if m, ok := s["minimum"].(float64); ok && d < m {
+		return v.fail(path, "%v is less than minimum %v", d, m)
+	}
+	if m, ok := s["maximum"].(float64); ok && d > m {
+		return v.fail(path, "%v is greater than maximum %v", d, m)
+	}
+	if m, ok := s["exclusiveMinimum"].(float64); ok && d <= m {
+		return v.fail(path, "%v must be greater than %v", d, m)
+	}
+	if m, ok := s["exclusiveMaximum"].(float64); ok && d >= m {
+		return v.fail(path, "%v must be less than %v", d, m)
+	}
+	if m, ok := s["multipleOf"].(float64); ok && m > 0 {
+		if q := d / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			return v.fail(path, "%v is not a multiple of %v", d, m)
+		}
+	}
+	return nil
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func compact(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,112 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("bad test JSON %s: %v", s, err)
+	}
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		doc    string
+		err    string // substring of the error, "" if valid
+	}{
+		{"empty schema", `{}`, `{"a":1}`, ""},
+		{"false schema", `{"properties":{"a":false}}`, `{"a":1}`, "/a: no value is allowed"},
+		{"type", `{"type":"string"}`, `1`, "expected string, got integer"},
+		{"type list", `{"type":["string","null"]}`, `null`, ""},
+		{"integer is a number", `{"type":"number"}`, `3`, ""},
+		{"number is not an integer", `{"type":"integer"}`, `3.5`, "expected integer, got number"},
+		{"required", `{"type":"object","required":["a"]}`, `{}`, `missing required property "a"`},
+		{"nested property", `{"properties":{"a":{"properties":{"b":{"type":"string"}}}}}`, `{"a":{"b":1}}`, "/a/b: expected string"},
+		{"no additional properties", `{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`, `unexpected property "b"`},
+		{"additional properties schema", `{"additionalProperties":{"type":"integer"}}`, `{"x":"y"}`, "/x: expected integer"},
+		{"enum", `{"enum":["a","b"]}`, `"c"`, "is not one of"},
+		{"const", `{"const":{"k":1}}`, `{"k":1}`, ""},
+		{"items", `{"items":{"type":"integer"}}`, `[1,"x"]`, "/1: expected integer"},
+		{"prefixItems", `{"prefixItems":[{"type":"string"}],"items":{"type":"integer"}}`, `["a",2]`, ""},
+		{"minItems", `{"minItems":2}`, `[1]`, "at least 2 items"},
+		{"uniqueItems", `{"uniqueItems":true}`, `[1,2,1]`, "items 0 and 2 are equal"},
+		{"maxLength counts runes", `{"maxLength":2}`, `"éé"`, ""},
+		{"pattern", `{"pattern":"^[a-z]+$"}`, `"A1"`, "does not match pattern"},
+		{"minimum", `{"minimum":1}`, `0`, "less than minimum"},
+		{"exclusiveMaximum", `{"exclusiveMaximum":1}`, `1`, "must be less than"},
+		{"multipleOf", `{"multipleOf":0.1}`, `0.3`, ""},
+		{"anyOf", `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `true`, "does not match any"},
+		{"oneOf", `{"oneOf":[{"type":"number"},{"type":"integer"}]}`, `1`, "matched 2"},
+		{"not", `{"not":{"type":"null"}}`, `null`, "must not match"},
+		{"ref", `{"$defs":{"s":{"type":"string"}},"properties":{"a":{"$ref":"#/$defs/s"}}}`, `{"a":1}`, "/a: expected string"},
+		{"recursive ref", `{"properties":{"kids":{"items":{"$ref":"#"}}},"additionalProperties":false}`, `{"kids":[{"kids":[{"x":1}]}]}`, `unexpected property "x"`},
+		{"unresolvable ref", `{"$ref":"#/$defs/nope"}`, `1`, "unresolvable $ref"},
+		{"self ref", `{"$ref":"#"}`, `1`, "loops without consuming"},
+		{"mutual refs", `{"$defs":{"a":{"$ref":"#/$defs/b"},"b":{"allOf":[{"$ref":"#/$defs/a"}]}},"$ref":"#/$defs/a"}`, `1`, "loops without consuming"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(mustParse(t, tt.schema), mustParse(t, tt.doc))
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && err == nil:
+				t.Errorf("no error, want %q", tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Errorf("error %q, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateDepth(t *testing.T) {
+	schema := `{}`
+	for range maxDepth + 1 {
+		schema = `{"items":` + schema + `}`
+	}
+	doc := strings.Repeat("[", maxDepth+1) + strings.Repeat("]", maxDepth+1)
+	err := Validate(mustParse(t, schema), mustParse(t, doc))
+	if err == nil || !strings.Contains(err.Error(), "levels deep") {
+		t.Errorf("got %v, want a depth error", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		err    string
+	}{
+		{"plain", `{"type":"object","properties":{"a":{"type":"string"}}}`, ""},
+		{"recursive through properties", `{"properties":{"next":{"$ref":"#"}}}`, ""},
+		{"recursive through defs", `{"$defs":{"node":{"properties":{"kids":{"items":{"$ref":"#/$defs/node"}}}}},"$ref":"#/$defs/node"}`, ""},
+		{"shared ref", `{"$defs":{"s":{"type":"string"}},"anyOf":[{"$ref":"#/$defs/s"},{"allOf":[{"$ref":"#/$defs/s"}]}]}`, ""},
+		{"self ref", `{"$ref":"#"}`, "refers back to itself"},
+		{"self ref in allOf", `{"allOf":[{"$ref":"#"}]}`, "refers back to itself"},
+		{"self ref in not", `{"properties":{"a":{"not":{"$ref":"#/properties/a"}}}}`, "refers back to itself"},
+		{"mutual refs", `{"$defs":{"a":{"$ref":"#/$defs/b"},"b":{"anyOf":[{"$ref":"#/$defs/a"}]}},"properties":{"x":{"$ref":"#/$defs/a"}}}`, "refers back to itself"},
+		{"unresolvable", `{"properties":{"a":{"items":{"$ref":"#/definitions/missing"}}}}`, "unresolvable $ref"},
+		{"remote ref", `{"$ref":"https://example.com/schema.json"}`, "only local $ref"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(mustParse(t, tt.schema))
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && err == nil:
+				t.Errorf("no error, want %q", tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Errorf("error %q, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Package llm defines the chat types shared by every LLM backend and the
+// Backend interface the API layer talks to.
+package llm
+
+import "context"
+
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	Thinking   string     `json:"thinking,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+type ToolCall struct {
+	ID       string           `json:"id,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// Tool is a function definition offered to the model
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+// Params are the per-request generation settings
+type Params struct {
+	MaxTokens   int
+	Stop        []string
+	Temperature *float64
+	TopP        *float64
+	TopK        *int
+	Tools       []Tool
+	// Format constrains the output: "json" for any JSON value, or a JSON
+	// schema (map) the answer must satisfy
+	Format interface{}
+	// Think enables reasoning: nil leaves the model default, a bool turns it
+	// on or off, a string is an effort level ("low", "medium", "high")
+	Think interface{}
+	// NumCtx is the context window to run with; 0 uses the backend default
+	NumCtx int
+}
+
+// ChatResponse is the result of a non-streaming chat call
+type ChatResponse struct {
+	Content          string
+	Thinking         string
+	ToolCalls        []ToolCall
+	DoneReason       string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// StreamChunk is one piece of a streamed answer; the last one has Done set
+// and carries the finish reason and token counts. A stream that fails ends
+// with a chunk carrying Err instead.
+type StreamChunk struct {
+	Content          string
+	Thinking         string
+	ToolCalls        []ToolCall
+	Done             bool
+	DoneReason       string
+	PromptTokens     int
+	CompletionTokens int
+	Err              error
+}
+
+// Backend is an upstream that serves chat models
+type Backend interface {
+	CallChat(ctx context.Context, messages []Message, model string, p Params) (*ChatResponse, error)
+	// StreamChat returns a channel of chunks; the final chunk has Done set.
+	// The channel is closed when the stream ends or ctx is cancelled.
+	StreamChat(ctx context.Context, messages []Message, model string, p Params) <-chan StreamChunk
+	ListModels(ctx context.Context) ([]string, error)
+	HealthCheck() (string, error)
+}
+
+// ContextSizer is implemented by backends that can report a model's maximum
+// context length in tokens
+type ContextSizer interface {
+	ContextLength(ctx context.Context, model string) (int, error)
+}
+
+// CompletionRequest is a plain text completion; Suffix asks for
+// fill-in-the-middle between Prompt and Suffix.
+type CompletionRequest struct {
+	Prompt string
+	Suffix string
+	Params
+}
+
+// Completer is implemented by backends that offer raw text completion
+type Completer interface {
+	Complete(ctx context.Context, model string, req CompletionRequest) (*ChatResponse, error)
+	StreamComplete(ctx context.Context, model string, req CompletionRequest) <-chan StreamChunk
+}
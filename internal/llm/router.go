@@ -0,0 +1,72 @@
+package llm
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Router picks the backend for a model name.
+//
+// Routes map a model name or glob ("qwen2.5-*") to a backend name; the most
+// specific match wins. A model can also be addressed as "<backend>/<model>",
+// in which case the prefix is stripped before the request goes upstream.
+// Anything unmatched goes to the default backend.
+type Router struct {
+	def      string
+	backends map[string]Backend
+	routes   map[string]string
+}
+
+func NewRouter(def string, backends map[string]Backend, routes map[string]string) *Router {
+	return &Router{def: def, backends: backends, routes: routes}
+}
+
+// Route returns the backend name, backend and upstream model name for model
+func (r *Router) Route(model string) (string, Backend, string) {
+	if prefix, rest, ok := strings.Cut(model, "/"); ok {
+		if b, ok := r.backends[prefix]; ok {
+			return prefix, b, rest
+		}
+	}
+
+	if name, ok := r.routes[model]; ok {
+		if b, ok := r.backends[name]; ok {
+			return name, b, model
+		}
+	}
+
+	best := ""
+	for pattern := range r.routes {
+		if ok, _ := path.Match(pattern, model); ok && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	if best != "" {
+		if b, ok := r.backends[r.routes[best]]; ok {
+			return r.routes[best], b, model
+		}
+	}
+	return r.def, r.backends[r.def], model
+}
+
+// Names lists backend names, default first
+func (r *Router) Names() []string {
+	names := []string{r.def}
+	var rest []string
+	for name := range r.backends {
+		if name != r.def {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+func (r *Router) Backend(name string) Backend {
+	return r.backends[name]
+}
+
+func (r *Router) Default() string {
+	return r.def
+}
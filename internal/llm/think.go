@@ -0,0 +1,83 @@
+package llm
+
+import "strings"
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// ThinkParser separates <think>...</think> sections from streamed text for
+// models that inline their reasoning. Tags may be split across chunks, so a
+// possible partial tag at the end of a chunk is held back until the next Feed.
+type ThinkParser struct {
+	inThink    bool
+	afterThink bool
+	buf        string
+}
+
+// Feed consumes the next piece of text and returns what can be emitted
+func (p *ThinkParser) Feed(s string) (thinking, content string) {
+	p.buf += s
+	var th, ct strings.Builder
+	for {
+		tag := thinkOpen
+		if p.inThink {
+			tag = thinkClose
+		}
+		i := strings.Index(p.buf, tag)
+		if i < 0 {
+			keep := partialSuffix(p.buf, tag)
+			p.emit(p.buf[:len(p.buf)-keep], &th, &ct)
+			p.buf = p.buf[len(p.buf)-keep:]
+			return th.String(), ct.String()
+		}
+		p.emit(p.buf[:i], &th, &ct)
+		p.buf = p.buf[i+len(tag):]
+		p.inThink = !p.inThink
+		p.afterThink = !p.inThink
+	}
+}
+
+// Flush returns whatever is still held back at the end of the stream
+func (p *ThinkParser) Flush() (thinking, content string) {
+	var th, ct strings.Builder
+	p.emit(p.buf, &th, &ct)
+	p.buf = ""
+	return th.String(), ct.String()
+}
+
+func (p *ThinkParser) emit(s string, th, ct *strings.Builder) {
+	if p.inThink {
+		th.WriteString(s)
+		return
+	}
+	// the answer usually starts with blank lines after </think>
+	if p.afterThink {
+		s = strings.TrimLeft(s, "\r\n")
+		if s == "" {
+			return
+		}
+		p.afterThink = false
+	}
+	ct.WriteString(s)
+}
+
+// partialSuffix is the length of the longest suffix of s that is a proper
+// prefix of tag
+func partialSuffix(s, tag string) int {
+	for n := len(tag) - 1; n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// SplitThinking extracts inline <think> sections from a complete answer
+func SplitThinking(s string) (thinking, content string) {
+	var p ThinkParser
+	th, ct := p.Feed(s)
+	th2, ct2 := p.Flush()
+	return strings.TrimSpace(th + th2), ct + ct2
+}
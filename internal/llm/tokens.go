@@ -0,0 +1,53 @@
+package llm
+
+import (
+	"encoding/json"
+	"unicode"
+	"unicode/utf8"
+)
+
+// perMessageTokens covers role markers and separators added by chat templates
+const perMessageTokens = 4
+
+// EstimateTokens approximates a BPE tokenizer without loading one: about four
+// characters per token for ASCII text, punctuation counted separately, and
+// one token per non-ASCII rune (CJK and the like tokenize far less densely).
+// It errs on the high side so truncation leaves some headroom.
+func EstimateTokens(s string) int {
+	letters, tokens := 0, 0
+	for _, r := range s {
+		switch {
+		case r >= utf8.RuneSelf:
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			letters++
+		case unicode.IsSpace(r):
+			// whitespace mostly merges into the following word
+		default:
+			tokens++
+		}
+	}
+	return tokens + (letters+3)/4
+}
+
+// EstimateMessages estimates the prompt size of a conversation
+func EstimateMessages(msgs []Message) int {
+	n := 0
+	for _, m := range msgs {
+		n += perMessageTokens + EstimateTokens(m.Content)
+		if len(m.ToolCalls) > 0 {
+			b, _ := json.Marshal(m.ToolCalls)
+			n += EstimateTokens(string(b))
+		}
+	}
+	return n
+}
+
+// EstimateTools estimates the prompt cost of tool definitions
+func EstimateTools(tools []Tool) int {
+	if len(tools) == 0 {
+		return 0
+	}
+	b, _ := json.Marshal(tools)
+	return EstimateTokens(string(b))
+}
@@ -2,13 +2,16 @@ package ocr
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/calvarado2004/LlamaMux/internal/upstream"
 )
 
 type Client struct {
@@ -16,6 +19,21 @@ type Client struct {
 	http    *http.Client
 }
 
+// Block is a single recognised region, when the backend reports them.
+type Block struct {
+	Text       string    `json:"text"`
+	BBox       []float64 `json:"bbox,omitempty"`
+	Confidence *float64  `json:"confidence,omitempty"`
+	Language   string    `json:"language,omitempty"`
+}
+
+// Result is the structured output of an OCR call.
+type Result struct {
+	Text     string  `json:"text"`
+	Language string  `json:"language,omitempty"`
+	Blocks   []Block `json:"blocks,omitempty"`
+}
+
 func NewClient(baseURL string) *Client {
 	return &Client{
 		BaseURL: baseURL,
@@ -23,50 +41,144 @@ func NewClient(baseURL string) *Client {
 	}
 }
 
-func (c *Client) FromBase64Image(b64Img string) string {
-	imgBytes, err := base64.StdEncoding.DecodeString(b64Img)
-	if err != nil {
-		return fmt.Sprintf("[OCR error: invalid base64: %v]", err)
+// FromBytes uploads an image or document to the OCR backend.
+// An empty filename is derived from the sniffed content type.
+func (c *Client) FromBytes(ctx context.Context, data []byte, filename string) (*Result, error) {
+	if filename == "" {
+		filename = filenameFor(data)
 	}
 
 	var buf bytes.Buffer
 	w := multipart.NewWriter(&buf)
-	fw, err := w.CreateFormFile("file", "image.png")
+	fw, err := w.CreateFormFile("file", filename)
 	if err != nil {
-		return fmt.Sprintf("[OCR error: %v]", err)
+		return nil, fmt.Errorf("OCR error: %v", err)
 	}
-	if _, err := fw.Write(imgBytes); err != nil {
-		return fmt.Sprintf("[OCR error: %v]", err)
+	if _, err := fw.Write(data); err != nil {
+		return nil, fmt.Errorf("OCR error: %v", err)
 	}
 	w.Close()
 
-	req, err := http.NewRequest("POST", c.BaseURL, &buf)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL, &buf)
 	if err != nil {
-		return fmt.Sprintf("[OCR error: %v]", err)
+		return nil, fmt.Errorf("OCR error: %v", err)
 	}
 	req.Header.Set("Content-Type", w.FormDataContentType())
 
 	resp, err := c.http.Do(req)
 	if err != nil {
-		return fmt.Sprintf("[OCR error: %v]", err)
+		return nil, upstream.FromTransport("OCR", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Sprintf("[OCR error: HTTP %d: %s]", resp.StatusCode, string(body))
+		return nil, upstream.FromStatus("OCR", resp.StatusCode, body)
+	}
+
+	var raw map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, upstream.BadResponse("OCR", err)
+	}
+	return parseResult(raw), nil
+}
+
+// parseResult accepts the common shapes returned by OCR servers:
+// a plain {"text"} object, optionally with "blocks", "lines" or "results".
+func parseResult(raw map[string]interface{}) *Result {
+	res := &Result{}
+	res.Text, _ = raw["text"].(string)
+	res.Language = firstString(raw, "language", "lang")
+
+	for _, key := range []string{"blocks", "lines", "results"} {
+		items, ok := raw[key].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, it := range items {
+			m, ok := it.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			b := Block{
+				Text:     firstString(m, "text"),
+				BBox:     parseBBox(m),
+				Language: firstString(m, "language", "lang"),
+			}
+			for _, ck := range []string{"confidence", "conf", "score"} {
+				if f, ok := m[ck].(float64); ok {
+					b.Confidence = &f
+					break
+				}
+			}
+			res.Blocks = append(res.Blocks, b)
+		}
+		break
 	}
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return fmt.Sprintf("[OCR error: %v]", err)
+	if res.Text == "" && len(res.Blocks) > 0 {
+		var lines []string
+		for _, b := range res.Blocks {
+			if b.Text != "" {
+				lines = append(lines, b.Text)
+			}
+		}
+		res.Text = strings.Join(lines, "\n")
 	}
-	if text, ok := result["text"].(string); ok {
-		return text
+	return res
+}
+
+func firstString(m map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := m[k].(string); ok && s != "" {
+			return s
+		}
 	}
 	return ""
 }
 
+// parseBBox flattens either [x0,y0,x1,y1] or [[x,y],...] polygons
+func parseBBox(m map[string]interface{}) []float64 {
+	for _, k := range []string{"bbox", "box"} {
+		arr, ok := m[k].([]interface{})
+		if !ok {
+			continue
+		}
+		var out []float64
+		for _, v := range arr {
+			switch p := v.(type) {
+			case float64:
+				out = append(out, p)
+			case []interface{}:
+				for _, q := range p {
+					if f, ok := q.(float64); ok {
+						out = append(out, f)
+					}
+				}
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func filenameFor(data []byte) string {
+	switch ct := http.DetectContentType(data); {
+	case ct == "image/jpeg":
+		return "image.jpg"
+	case ct == "image/gif":
+		return "image.gif"
+	case ct == "image/webp":
+		return "image.webp"
+	case ct == "image/bmp":
+		return "image.bmp"
+	case ct == "application/pdf":
+		return "document.pdf"
+	default:
+		return "image.png"
+	}
+}
+
 func (c *Client) HealthCheck() (string, error) {
 	healthURL := c.BaseURL
 	if len(healthURL) >= 4 && healthURL[len(healthURL)-4:] == "/ocr" {
@@ -3,33 +3,75 @@ package ollama
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/calvarado2004/LlamaMux/internal/llm"
+	"github.com/calvarado2004/LlamaMux/internal/upstream"
 )
 
 type Config struct {
-	BaseURL   string
-	NumCtx    int
+	BaseURL    string
+	NumCtx     int
 	ServerName string
-}
-
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	// AutoPull pulls a model the first time it is requested if Ollama does
+	// not have it and it matches a name or glob in PullModels
+	AutoPull   bool
+	PullModels []string
+	// KeepAlive maps a model name or glob to how long Ollama keeps it
+	// loaded after a request ("30m", or seconds; -1 keeps it for ever).
+	// Unmatched models get Ollama's default.
+	KeepAlive map[string]string
 }
 
 type Options struct {
-	NumCtx int `json:"num_ctx"`
+	NumCtx      int      `json:"num_ctx"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	TopK        *int     `json:"top_k,omitempty"`
 }
 
 type ChatRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream"`
-	Options  Options   `json:"options"`
+	Model    string        `json:"model"`
+	Messages []llm.Message `json:"messages"`
+	Stream   bool          `json:"stream"`
+	Options  Options       `json:"options"`
+	Tools    []llm.Tool    `json:"tools,omitempty"`
+	Format   interface{}   `json:"format,omitempty"`
+	Think    interface{}   `json:"think,omitempty"`
+	// KeepAlive is a duration string or a number of seconds
+	KeepAlive interface{} `json:"keep_alive,omitempty"`
+}
+
+// chatChunk is the wire format of /api/chat responses
+type chatChunk struct {
+	Message         llm.Message `json:"message"`
+	Response        string      `json:"response"`
+	Thinking        string      `json:"thinking"`
+	Done            bool        `json:"done"`
+	DoneReason      string      `json:"done_reason"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+	EvalCount       int         `json:"eval_count"`
+	// Error is sent in place of a chunk when generation fails mid-stream
+	Error string `json:"error"`
+}
+
+type GenerateRequest struct {
+	Model     string      `json:"model"`
+	Prompt    string      `json:"prompt"`
+	Suffix    string      `json:"suffix,omitempty"`
+	Raw       bool        `json:"raw,omitempty"`
+	Stream    bool        `json:"stream"`
+	Options   Options     `json:"options"`
+	KeepAlive interface{} `json:"keep_alive,omitempty"`
 }
 
 type TagsResponse struct {
@@ -38,137 +80,294 @@ type TagsResponse struct {
 	} `json:"models"`
 }
 
+const service = "Ollama"
+
+var (
+	_ llm.Backend      = (*Client)(nil)
+	_ llm.Completer    = (*Client)(nil)
+	_ llm.ContextSizer = (*Client)(nil)
+)
+
 type Client struct {
 	cfg    Config
 	http   *http.Client
+	stream *http.Client
+
+	mu      sync.Mutex
+	ctxLen  map[string]int
+	present map[string]bool
+	// auto-pulls in flight by model
+	pulls map[string]*pull
 }
 
 func NewClient(cfg Config) *Client {
 	return &Client{
-		cfg: cfg,
-		http: &http.Client{Timeout: 180 * time.Second},
+		cfg:     cfg,
+		http:    &http.Client{Timeout: 180 * time.Second},
+		stream:  &http.Client{},
+		ctxLen:  map[string]int{},
+		present: map[string]bool{},
+		pulls:   map[string]*pull{},
 	}
 }
 
-func (c *Client) chatRequest(messages []Message, model string, numCtx int, stream bool) (*http.Response, error) {
+func (c *Client) chatRequest(ctx context.Context, messages []llm.Message, model string, numCtx int, stream bool, p llm.Params) (*http.Response, error) {
 	payload := ChatRequest{
 		Model:    model,
 		Messages: messages,
 		Stream:   stream,
-		Options:  Options{NumCtx: numCtx},
+		Options: Options{
+			NumCtx:      numCtx,
+			NumPredict:  p.MaxTokens,
+			Stop:        p.Stop,
+			Temperature: p.Temperature,
+			TopP:        p.TopP,
+			TopK:        p.TopK,
+		},
+		Tools:     p.Tools,
+		Format:    p.Format,
+		Think:     think(model, p.Think),
+		KeepAlive: c.keepAliveFor(model),
 	}
 	b, _ := json.Marshal(payload)
 
-	req, err := http.NewRequest("POST", c.cfg.BaseURL+"/api/chat", bytes.NewReader(b))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.cfg.BaseURL+"/api/chat", bytes.NewReader(b))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	return c.http.Do(req)
+	return c.do(req, stream)
 }
 
-// CallChat – non-streaming, with context fallback
-func (c *Client) CallChat(messages []Message, model string) (string, error) {
+// do sends req and turns transport failures and error statuses into
+// upstream errors. Streams are bounded by ctx rather than the client timeout.
+func (c *Client) do(req *http.Request, stream bool) (*http.Response, error) {
+	client := c.http
+	if stream {
+		client = c.stream
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, upstream.FromTransport(service, err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, upstream.FromStatus(service, resp.StatusCode, body)
+	}
+	return resp, nil
+}
+
+// think maps an effort level onto Ollama's think option. Only gpt-oss takes
+// levels; other thinking models accept a bool.
+func think(model string, v interface{}) interface{} {
+	level, ok := v.(string)
+	if !ok {
+		return v
+	}
+	if level == "none" {
+		return false
+	}
+	if !strings.Contains(model, "gpt-oss") {
+		return true
+	}
+	if level == "minimal" {
+		return "low"
+	}
+	return level
+}
+
+// CallChat – non-streaming
+func (c *Client) CallChat(ctx context.Context, messages []llm.Message, model string, p llm.Params) (*llm.ChatResponse, error) {
 	if model == "" {
-		return "", fmt.Errorf("model is required")
+		return nil, fmt.Errorf("model is required")
+	}
+	if err := c.ensure(ctx, model); err != nil {
+		return nil, err
 	}
 
-	tries := []int{c.cfg.NumCtx}
-	for _, v := range []int{65536, 32768, 8192} {
-		if v != c.cfg.NumCtx {
-			tries = append(tries, v)
-		}
+	resp, err := c.chatRequest(ctx, messages, model, c.numCtx(p), false, p)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data chatChunk
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, upstream.BadResponse(service, err)
 	}
 
-	var lastErr error
-	for i, ctx := range tries {
-		resp, err := c.chatRequest(messages, model, ctx, false)
+	content := data.Message.Content
+	if content == "" {
+		content = data.Response
+	}
+	thinking, content := llm.SplitThinking(content)
+	if data.Message.Thinking != "" {
+		thinking = data.Message.Thinking
+	}
+	return &llm.ChatResponse{
+		Content:          content,
+		Thinking:         thinking,
+		ToolCalls:        data.Message.ToolCalls,
+		DoneReason:       data.DoneReason,
+		PromptTokens:     data.PromptEvalCount,
+		CompletionTokens: data.EvalCount,
+	}, nil
+}
+
+func (c *Client) numCtx(p llm.Params) int {
+	if p.NumCtx > 0 {
+		return p.NumCtx
+	}
+	return c.cfg.NumCtx
+}
+
+// StreamChat returns a channel of chunks; the final chunk has Done set
+func (c *Client) StreamChat(ctx context.Context, messages []llm.Message, model string, p llm.Params) <-chan llm.StreamChunk {
+	ch := make(chan llm.StreamChunk)
+	go func() {
+		defer close(ch)
+
+		if err := c.ensure(ctx, model); err != nil {
+			ch <- llm.StreamChunk{Err: err}
+			return
+		}
+		resp, err := c.chatRequest(ctx, messages, model, c.numCtx(p), true, p)
 		if err != nil {
-			lastErr = err
-			continue
+			ch <- llm.StreamChunk{Err: err}
+			return
 		}
 		defer resp.Body.Close()
-		if resp.StatusCode >= 400 {
-			body, _ := io.ReadAll(resp.Body)
-			lastErr = fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
-			continue
-		}
 
-		var data map[string]interface{}
-		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-			lastErr = err
-			continue
-		}
+		relay(ch, resp.Body)
+	}()
+	return ch
+}
 
-		msg, _ := data["message"].(map[string]interface{})
-		content, _ := msg["content"].(string)
-		if content == "" {
-			content, _ = data["response"].(string)
-		}
+func (c *Client) generateRequest(ctx context.Context, model string, r llm.CompletionRequest, stream bool) (*http.Response, error) {
+	payload := GenerateRequest{
+		Model:  model,
+		Prompt: r.Prompt,
+		Suffix: r.Suffix,
+		// raw skips the chat template; FIM needs the template's suffix handling
+		Raw:    r.Suffix == "",
+		Stream: stream,
+		Options: Options{
+			NumCtx:      c.numCtx(r.Params),
+			NumPredict:  r.MaxTokens,
+			Stop:        r.Stop,
+			Temperature: r.Temperature,
+			TopP:        r.TopP,
+			TopK:        r.TopK,
+		},
+		KeepAlive: c.keepAliveFor(model),
+	}
+	b, _ := json.Marshal(payload)
 
-		if i > 0 {
-			content = fmt.Sprintf("[ctx fallback to %d]\n%s", ctx, content)
-		}
-		return content, nil
+	req, err := http.NewRequestWithContext(ctx, "POST", c.cfg.BaseURL+"/api/generate", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, stream)
+}
+
+// Complete wraps /api/generate (non-streaming)
+func (c *Client) Complete(ctx context.Context, model string, r llm.CompletionRequest) (*llm.ChatResponse, error) {
+	if model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	if err := c.ensure(ctx, model); err != nil {
+		return nil, err
+	}
+	resp, err := c.generateRequest(ctx, model, r, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data chatChunk
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, upstream.BadResponse(service, err)
 	}
-	return "", fmt.Errorf("Ollama error after ctx fallbacks: %v", lastErr)
+	return &llm.ChatResponse{
+		Content:          data.Response,
+		DoneReason:       data.DoneReason,
+		PromptTokens:     data.PromptEvalCount,
+		CompletionTokens: data.EvalCount,
+	}, nil
 }
 
-// StreamChat returns a channel of delta strings
-func (c *Client) StreamChat(messages []Message, model string) <-chan string {
-	ch := make(chan string)
+// StreamComplete streams /api/generate; the final chunk has Done set
+func (c *Client) StreamComplete(ctx context.Context, model string, r llm.CompletionRequest) <-chan llm.StreamChunk {
+	ch := make(chan llm.StreamChunk)
 	go func() {
 		defer close(ch)
 
-		resp, err := c.chatRequest(messages, model, c.cfg.NumCtx, true)
-		if err != nil {
-			ch <- fmt.Sprintf("\n[Ollama streaming error: %v]\n", err)
+		if err := c.ensure(ctx, model); err != nil {
+			ch <- llm.StreamChunk{Err: err}
 			return
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode >= 400 {
-			body, _ := io.ReadAll(resp.Body)
-			ch <- fmt.Sprintf("\n[Ollama streaming error: HTTP %d: %s]\n", resp.StatusCode, string(body))
+		resp, err := c.generateRequest(ctx, model, r, true)
+		if err != nil {
+			ch <- llm.StreamChunk{Err: err}
 			return
 		}
+		defer resp.Body.Close()
 
-		scanner := bufio.NewScanner(resp.Body)
-		for scanner.Scan() {
-			line := scanner.Text()
-			line = trimDataPrefix(line)
-			if line == "" {
-				continue
-			}
+		relay(ch, resp.Body)
+	}()
+	return ch
+}
 
-			var data map[string]interface{}
-			if err := json.Unmarshal([]byte(line), &data); err != nil {
-				continue
-			}
+// relay forwards NDJSON chunks from /api/chat or /api/generate. Reasoning
+// comes either in the "thinking" field or inline as <think> tags.
+func relay(ch chan<- llm.StreamChunk, body io.Reader) {
+	var parser llm.ThinkParser
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		line = trimDataPrefix(line)
+		if line == "" {
+			continue
+		}
 
-			if done, ok := data["done"].(bool); ok && done {
-				break
-			}
+		var data chatChunk
+		if err := json.Unmarshal([]byte(line), &data); err != nil {
+			continue
+		}
+		if data.Error != "" {
+			ch <- llm.StreamChunk{Err: upstream.FromMessage(service, data.Error)}
+			return
+		}
 
-			var delta string
-			if msg, ok := data["message"].(map[string]interface{}); ok {
-				if c, ok := msg["content"].(string); ok {
-					delta = c
-				}
-			}
-			if delta == "" {
-				if c, ok := data["response"].(string); ok {
-					delta = c
-				}
-			}
-			if delta != "" {
-				ch <- delta
+		delta := data.Message.Content
+		if delta == "" {
+			delta = data.Response
+		}
+		thinking, delta := parser.Feed(delta)
+		thinking = data.Message.Thinking + data.Thinking + thinking
+		if data.Done {
+			th, ct := parser.Flush()
+			ch <- llm.StreamChunk{
+				Content:          delta + ct,
+				Thinking:         thinking + th,
+				ToolCalls:        data.Message.ToolCalls,
+				Done:             true,
+				DoneReason:       data.DoneReason,
+				PromptTokens:     data.PromptEvalCount,
+				CompletionTokens: data.EvalCount,
 			}
+			return
 		}
-		if err := scanner.Err(); err != nil {
-			ch <- fmt.Sprintf("\n[Ollama streaming error: %v]\n", err)
+		if delta != "" || thinking != "" || len(data.Message.ToolCalls) > 0 {
+			ch <- llm.StreamChunk{Content: delta, Thinking: thinking, ToolCalls: data.Message.ToolCalls}
 		}
-	}()
-	return ch
+	}
+	if err := scanner.Err(); err != nil {
+		ch <- llm.StreamChunk{Err: upstream.FromTransport(service, err)}
+	}
 }
 
 func trimDataPrefix(line string) string {
@@ -183,21 +382,21 @@ func trimDataPrefix(line string) string {
 }
 
 // ListModels wraps /api/tags
-func (c *Client) ListModels() ([]string, error) {
-	req, err := http.NewRequest("GET", c.cfg.BaseURL+"/api/tags", nil)
+func (c *Client) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.cfg.BaseURL+"/api/tags", nil)
 	if err != nil {
 		return nil, err
 	}
 	client := &http.Client{Timeout: 5 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, upstream.FromTransport(service, err)
 	}
 	defer resp.Body.Close()
 
 	var tags TagsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
-		return nil, err
+		return nil, upstream.BadResponse(service, err)
 	}
 	var out []string
 	for _, m := range tags.Models {
@@ -208,6 +407,40 @@ func (c *Client) ListModels() ([]string, error) {
 	return out, nil
 }
 
+// ContextLength reads the model's trained context length from /api/show
+// ("<arch>.context_length" in model_info). Results are cached per model.
+func (c *Client) ContextLength(ctx context.Context, model string) (int, error) {
+	c.mu.Lock()
+	n, ok := c.ctxLen[model]
+	c.mu.Unlock()
+	if ok {
+		return n, nil
+	}
+
+	if err := c.ensure(ctx, model); err != nil {
+		return 0, err
+	}
+	show, err := c.Show(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+	info, _ := show["model_info"].(map[string]interface{})
+	for k, v := range info {
+		if f, ok := v.(float64); ok && strings.HasSuffix(k, ".context_length") {
+			n = int(f)
+			break
+		}
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("no context_length for %s", model)
+	}
+
+	c.mu.Lock()
+	c.ctxLen[model] = n
+	c.mu.Unlock()
+	return n, nil
+}
+
 // HealthCheck simple GET on root
 func (c *Client) HealthCheck() (string, error) {
 	req, err := http.NewRequest("GET", c.cfg.BaseURL+"/", nil)
@@ -225,3 +458,16 @@ func (c *Client) HealthCheck() (string, error) {
 	return fmt.Sprintf("bad:%d", resp.StatusCode), nil
 }
 
+// Proxy forwards a raw request to the Ollama API (path like "/api/chat").
+// It uses a client without an overall timeout so long streams are bounded
+// only by ctx; the caller must close the response body.
+func (c *Client) Proxy(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.stream.Do(req)
+}
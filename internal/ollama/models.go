@@ -0,0 +1,269 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/calvarado2004/LlamaMux/internal/upstream"
+)
+
+// Model management: /api/show, /api/pull, /api/delete, /api/ps and
+// preloading through keep_alive.
+
+// PullProgress is one status line of /api/pull
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body interface{}, stream bool) (*http.Response, error) {
+	b, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.BaseURL+path, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, stream)
+}
+
+// Show returns /api/show for model as decoded JSON
+func (c *Client) Show(ctx context.Context, model string) (map[string]interface{}, error) {
+	resp, err := c.send(ctx, http.MethodPost, "/api/show", map[string]string{"model": model}, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var show map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return nil, upstream.BadResponse(service, err)
+	}
+	c.mu.Lock()
+	c.present[model] = true
+	c.mu.Unlock()
+	return show, nil
+}
+
+// Pull downloads model, calling progress (if set) for every status line
+func (c *Client) Pull(ctx context.Context, model string, progress func(PullProgress)) error {
+	resp, err := c.send(ctx, http.MethodPost, "/api/pull", map[string]interface{}{"model": model, "stream": true}, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var line struct {
+			PullProgress
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		if line.Error != "" {
+			return upstream.FromMessage(service, line.Error)
+		}
+		if progress != nil {
+			progress(line.PullProgress)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return upstream.FromTransport(service, err)
+	}
+	c.mu.Lock()
+	c.present[model] = true
+	c.mu.Unlock()
+	return nil
+}
+
+// Delete removes model from the Ollama host
+func (c *Client) Delete(ctx context.Context, model string) error {
+	resp, err := c.send(ctx, http.MethodDelete, "/api/delete", map[string]string{"model": model}, false)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	c.mu.Lock()
+	delete(c.present, model)
+	delete(c.ctxLen, model)
+	c.mu.Unlock()
+	return nil
+}
+
+// PS returns /api/ps: the models currently loaded
+func (c *Client) PS(ctx context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.BaseURL+"/api/ps", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ps map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&ps); err != nil {
+		return nil, upstream.BadResponse(service, err)
+	}
+	return ps, nil
+}
+
+// Load loads model into memory and keeps it there for keepAlive (a
+// duration such as "30m", seconds, or -1 for ever). A nil keepAlive uses
+// the model's Config.KeepAlive.
+func (c *Client) Load(ctx context.Context, model string, keepAlive interface{}) error {
+	if err := c.ensure(ctx, model); err != nil {
+		return err
+	}
+	if keepAlive == nil {
+		keepAlive = c.keepAliveFor(model)
+	}
+	return c.keepAlive(ctx, model, keepAlive)
+}
+
+// Loaded reports which models Ollama currently holds in memory
+func (c *Client) Loaded(ctx context.Context) (map[string]bool, error) {
+	ps, err := c.PS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	loaded := map[string]bool{}
+	list, _ := ps["models"].([]interface{})
+	for _, m := range list {
+		if entry, ok := m.(map[string]interface{}); ok {
+			name, _ := entry["name"].(string)
+			loaded[fullName(name)] = true
+		}
+	}
+	return loaded, nil
+}
+
+// IsLoaded reports whether model is in loaded, as returned by Loaded
+func IsLoaded(loaded map[string]bool, model string) bool {
+	return loaded[fullName(model)]
+}
+
+// fullName adds the implicit ":latest" tag
+func fullName(model string) string {
+	if !strings.Contains(model, ":") {
+		return model + ":latest"
+	}
+	return model
+}
+
+// keepAliveFor looks model up in Config.KeepAlive, exact names first and
+// then the longest matching glob. Numbers are sent as seconds.
+func (c *Client) keepAliveFor(model string) interface{} {
+	v, ok := c.cfg.KeepAlive[model]
+	if !ok {
+		best := ""
+		for pattern := range c.cfg.KeepAlive {
+			if m, _ := path.Match(pattern, model); m && len(pattern) > len(best) {
+				best = pattern
+			}
+		}
+		if best == "" {
+			return nil
+		}
+		v = c.cfg.KeepAlive[best]
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		return n
+	}
+	return v
+}
+
+// Unload evicts model from memory
+func (c *Client) Unload(ctx context.Context, model string) error {
+	return c.keepAlive(ctx, model, 0)
+}
+
+// keepAlive sends a generate request without a prompt, which only loads
+// the model and sets how long it stays loaded
+func (c *Client) keepAlive(ctx context.Context, model string, keepAlive interface{}) error {
+	body := map[string]interface{}{"model": model, "stream": false}
+	if keepAlive != nil {
+		body["keep_alive"] = keepAlive
+	}
+	resp, err := c.send(ctx, http.MethodPost, "/api/generate", body, false)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// pull is an auto-pull in flight; err is set before done is closed
+type pull struct {
+	done chan struct{}
+	err  error
+}
+
+// ensure pulls model first when Config.AutoPull is set, the model is in
+// Config.PullModels and Ollama does not have it. Requests for the same model
+// share one pull, which outlives a cancelled request so it is not wasted;
+// each request only waits as long as its own context allows.
+func (c *Client) ensure(ctx context.Context, model string) error {
+	if !c.cfg.AutoPull || model == "" {
+		return nil
+	}
+	c.mu.Lock()
+	if c.present[model] {
+		c.mu.Unlock()
+		return nil
+	}
+	p, ok := c.pulls[model]
+	if !ok {
+		p = &pull{done: make(chan struct{})}
+		c.pulls[model] = p
+		go c.autoPull(context.WithoutCancel(ctx), model, p)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+func (c *Client) autoPull(ctx context.Context, model string, p *pull) {
+	_, err := c.Show(ctx, model)
+	if kind, _ := upstream.KindOf(err); err != nil && kind == upstream.ModelNotFound {
+		if c.pullable(model) {
+			log.Printf("auto-pull: pulling %s", model)
+			if err = c.Pull(ctx, model, nil); err == nil {
+				log.Printf("auto-pull: %s is ready", model)
+			}
+		} else {
+			log.Printf("auto-pull: not pulling %s, it is not a configured or routed model", model)
+		}
+	}
+	c.mu.Lock()
+	delete(c.pulls, model)
+	c.mu.Unlock()
+	p.err = err
+	close(p.done)
+}
+
+// pullable reports whether model matches a name or glob in Config.PullModels
+func (c *Client) pullable(model string) bool {
+	for _, pattern := range c.cfg.PullModels {
+		if ok, _ := path.Match(pattern, model); ok || pattern == model {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,497 @@
+// Package openai is a client for upstream servers that speak the OpenAI
+// chat completions API (vLLM, llama.cpp server, LM Studio, ...).
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/calvarado2004/LlamaMux/internal/llm"
+	"github.com/calvarado2004/LlamaMux/internal/upstream"
+)
+
+const service = "OpenAI-compatible backend"
+
+var (
+	_ llm.Backend      = (*Client)(nil)
+	_ llm.Completer    = (*Client)(nil)
+	_ llm.ContextSizer = (*Client)(nil)
+)
+
+type Client struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+	stream  *http.Client
+
+	mu     sync.Mutex
+	ctxLen map[string]int
+}
+
+// NewClient takes the API root including the version, e.g. http://host:8000/v1
+func NewClient(baseURL, apiKey string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		http:    &http.Client{Timeout: 180 * time.Second},
+		stream:  &http.Client{},
+		ctxLen:  map[string]int{},
+	}
+}
+
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// vLLM and llama.cpp use reasoning_content, some servers "reasoning"
+	ReasoningContent string     `json:"reasoning_content,omitempty"`
+	Reasoning        string     `json:"reasoning,omitempty"`
+	ToolCalls        []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID       string     `json:"tool_call_id,omitempty"`
+}
+
+type toolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type chatRequest struct {
+	Model         string                 `json:"model"`
+	Messages      []message              `json:"messages"`
+	Stream        bool                   `json:"stream"`
+	StreamOptions map[string]interface{} `json:"stream_options,omitempty"`
+	MaxTokens     int                    `json:"max_tokens,omitempty"`
+	Stop          []string               `json:"stop,omitempty"`
+	Temperature   *float64               `json:"temperature,omitempty"`
+	TopP          *float64               `json:"top_p,omitempty"`
+	TopK          *int                   `json:"top_k,omitempty"`
+	Tools         []llm.Tool             `json:"tools,omitempty"`
+	ResponseFmt   interface{}            `json:"response_format,omitempty"`
+	Effort        string                 `json:"reasoning_effort,omitempty"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message      message `json:"message"`
+		Delta        message `json:"delta"`
+		Text         string  `json:"text"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *usage `json:"usage"`
+	// Error is sent in place of a chunk when generation fails mid-stream
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func toWire(messages []llm.Message) []message {
+	out := make([]message, 0, len(messages))
+	for _, m := range messages {
+		wm := message{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for i, tc := range m.ToolCalls {
+			var c toolCall
+			c.ID = tc.ID
+			if c.ID == "" {
+				c.ID = fmt.Sprintf("call_%d", i)
+			}
+			c.Type = "function"
+			c.Function.Name = tc.Function.Name
+			args, _ := json.Marshal(tc.Function.Arguments)
+			c.Function.Arguments = string(args)
+			wm.ToolCalls = append(wm.ToolCalls, c)
+		}
+		out = append(out, wm)
+	}
+	return out
+}
+
+func fromWire(calls []toolCall) []llm.ToolCall {
+	var out []llm.ToolCall
+	for _, c := range calls {
+		args := map[string]interface{}{}
+		if c.Function.Arguments != "" {
+			_ = json.Unmarshal([]byte(c.Function.Arguments), &args)
+		}
+		out = append(out, llm.ToolCall{
+			ID:       c.ID,
+			Function: llm.ToolCallFunction{Name: c.Function.Name, Arguments: args},
+		})
+	}
+	return out
+}
+
+// doneReason maps OpenAI finish reasons onto the Ollama vocabulary used by llm
+func doneReason(finish string) string {
+	if finish == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+// responseFormat maps llm.Params.Format onto OpenAI's response_format
+func responseFormat(format interface{}) interface{} {
+	switch f := format.(type) {
+	case nil:
+		return nil
+	case string:
+		return map[string]interface{}{"type": "json_object"}
+	default:
+		return map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "response",
+				"schema": f,
+				"strict": true,
+			},
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body interface{}, stream bool) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	client := c.http
+	if stream {
+		client = c.stream
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, upstream.FromTransport(service, err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, upstream.FromStatus(service, resp.StatusCode, b)
+	}
+	return resp, nil
+}
+
+func (c *Client) request(messages []llm.Message, model string, stream bool, p llm.Params) chatRequest {
+	req := chatRequest{
+		Model:       model,
+		Messages:    toWire(messages),
+		Stream:      stream,
+		MaxTokens:   p.MaxTokens,
+		Stop:        p.Stop,
+		Temperature: p.Temperature,
+		TopP:        p.TopP,
+		TopK:        p.TopK,
+		Tools:       p.Tools,
+		ResponseFmt: responseFormat(p.Format),
+	}
+	if effort, ok := p.Think.(string); ok && effort != "none" {
+		req.Effort = effort
+	}
+	if stream {
+		req.StreamOptions = map[string]interface{}{"include_usage": true}
+	}
+	return req
+}
+
+func (c *Client) CallChat(ctx context.Context, messages []llm.Message, model string, p llm.Params) (*llm.ChatResponse, error) {
+	if model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	resp, err := c.do(ctx, "POST", "/chat/completions", c.request(messages, model, false, p), false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, upstream.BadResponse(service, err)
+	}
+	if len(data.Choices) == 0 {
+		return nil, upstream.BadResponse(service, errors.New("no choices in response"))
+	}
+	msg := data.Choices[0].Message
+	thinking, content := llm.SplitThinking(msg.Content)
+	if r := msg.ReasoningContent + msg.Reasoning; r != "" {
+		thinking = r
+	}
+	out := &llm.ChatResponse{
+		Content:    content,
+		Thinking:   thinking,
+		ToolCalls:  fromWire(msg.ToolCalls),
+		DoneReason: doneReason(data.Choices[0].FinishReason),
+	}
+	if data.Usage != nil {
+		out.PromptTokens = data.Usage.PromptTokens
+		out.CompletionTokens = data.Usage.CompletionTokens
+	}
+	return out, nil
+}
+
+func (c *Client) StreamChat(ctx context.Context, messages []llm.Message, model string, p llm.Params) <-chan llm.StreamChunk {
+	return c.streamSSE(ctx, "/chat/completions", c.request(messages, model, true, p))
+}
+
+// streamSSE relays SSE deltas from /chat/completions or /completions. Tool
+// call fragments are accumulated by index and delivered whole on the final chunk.
+func (c *Client) streamSSE(ctx context.Context, path string, body interface{}) <-chan llm.StreamChunk {
+	ch := make(chan llm.StreamChunk)
+	go func() {
+		defer close(ch)
+
+		resp, err := c.do(ctx, "POST", path, body, true)
+		if err != nil {
+			ch <- llm.StreamChunk{Err: err}
+			return
+		}
+		defer resp.Body.Close()
+
+		final := llm.StreamChunk{Done: true, DoneReason: "stop"}
+		calls := map[int]*toolCall{}
+		var parser llm.ThinkParser
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			line = strings.TrimSpace(line[5:])
+			if line == "[DONE]" {
+				break
+			}
+
+			var data chatResponse
+			if err := json.Unmarshal([]byte(line), &data); err != nil {
+				continue
+			}
+			if data.Error != nil {
+				ch <- llm.StreamChunk{Err: upstream.FromMessage(service, data.Error.Message)}
+				return
+			}
+			if data.Usage != nil {
+				final.PromptTokens = data.Usage.PromptTokens
+				final.CompletionTokens = data.Usage.CompletionTokens
+			}
+			if len(data.Choices) == 0 {
+				continue
+			}
+			choice := data.Choices[0]
+			for _, tc := range choice.Delta.ToolCalls {
+				acc, ok := calls[tc.Index]
+				if !ok {
+					acc = &toolCall{Index: tc.Index}
+					calls[tc.Index] = acc
+				}
+				if tc.ID != "" {
+					acc.ID = tc.ID
+				}
+				if tc.Function.Name != "" {
+					acc.Function.Name = tc.Function.Name
+				}
+				acc.Function.Arguments += tc.Function.Arguments
+			}
+			if choice.FinishReason != "" {
+				final.DoneReason = doneReason(choice.FinishReason)
+			}
+			thinking, delta := parser.Feed(choice.Delta.Content + choice.Text)
+			thinking = choice.Delta.ReasoningContent + choice.Delta.Reasoning + thinking
+			if delta != "" || thinking != "" {
+				ch <- llm.StreamChunk{Content: delta, Thinking: thinking}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			ch <- llm.StreamChunk{Err: upstream.FromTransport(service, err)}
+			return
+		}
+
+		indexes := make([]int, 0, len(calls))
+		for i := range calls {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		var ordered []toolCall
+		for _, i := range indexes {
+			ordered = append(ordered, *calls[i])
+		}
+		final.ToolCalls = fromWire(ordered)
+		final.Thinking, final.Content = parser.Flush()
+		ch <- final
+	}()
+	return ch
+}
+
+type completionRequest struct {
+	Model         string                 `json:"model"`
+	Prompt        string                 `json:"prompt"`
+	Suffix        string                 `json:"suffix,omitempty"`
+	Stream        bool                   `json:"stream"`
+	StreamOptions map[string]interface{} `json:"stream_options,omitempty"`
+	MaxTokens     int                    `json:"max_tokens,omitempty"`
+	Stop          []string               `json:"stop,omitempty"`
+	Temperature   *float64               `json:"temperature,omitempty"`
+	TopP          *float64               `json:"top_p,omitempty"`
+	TopK          *int                   `json:"top_k,omitempty"`
+}
+
+func completion(model string, r llm.CompletionRequest, stream bool) completionRequest {
+	req := completionRequest{
+		Model:       model,
+		Prompt:      r.Prompt,
+		Suffix:      r.Suffix,
+		Stream:      stream,
+		MaxTokens:   r.MaxTokens,
+		Stop:        r.Stop,
+		Temperature: r.Temperature,
+		TopP:        r.TopP,
+		TopK:        r.TopK,
+	}
+	if stream {
+		req.StreamOptions = map[string]interface{}{"include_usage": true}
+	}
+	return req
+}
+
+// Complete wraps POST /completions
+func (c *Client) Complete(ctx context.Context, model string, r llm.CompletionRequest) (*llm.ChatResponse, error) {
+	if model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	resp, err := c.do(ctx, "POST", "/completions", completion(model, r, false), false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, upstream.BadResponse(service, err)
+	}
+	if len(data.Choices) == 0 {
+		return nil, upstream.BadResponse(service, errors.New("no choices in response"))
+	}
+	out := &llm.ChatResponse{
+		Content:    data.Choices[0].Text,
+		DoneReason: doneReason(data.Choices[0].FinishReason),
+	}
+	if data.Usage != nil {
+		out.PromptTokens = data.Usage.PromptTokens
+		out.CompletionTokens = data.Usage.CompletionTokens
+	}
+	return out, nil
+}
+
+func (c *Client) StreamComplete(ctx context.Context, model string, r llm.CompletionRequest) <-chan llm.StreamChunk {
+	return c.streamSSE(ctx, "/completions", completion(model, r, true))
+}
+
+type modelList struct {
+	Data []struct {
+		ID string `json:"id"`
+		// vLLM
+		MaxModelLen int `json:"max_model_len"`
+		// llama.cpp server
+		Meta struct {
+			NCtxTrain int `json:"n_ctx_train"`
+		} `json:"meta"`
+	} `json:"data"`
+}
+
+func (c *Client) models(ctx context.Context) (*modelList, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	resp, err := c.do(ctx, "GET", "/models", nil, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data modelList
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, upstream.BadResponse(service, err)
+	}
+	return &data, nil
+}
+
+// ListModels wraps GET /models
+func (c *Client) ListModels(ctx context.Context) ([]string, error) {
+	data, err := c.models(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, m := range data.Data {
+		if m.ID != "" {
+			out = append(out, m.ID)
+		}
+	}
+	return out, nil
+}
+
+// ContextLength uses what the server advertises in /models, which not every
+// OpenAI-compatible server does
+func (c *Client) ContextLength(ctx context.Context, model string) (int, error) {
+	c.mu.Lock()
+	n, ok := c.ctxLen[model]
+	c.mu.Unlock()
+	if ok {
+		return n, nil
+	}
+
+	data, err := c.models(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range data.Data {
+		if m.ID != model {
+			continue
+		}
+		n = m.MaxModelLen
+		if n == 0 {
+			n = m.Meta.NCtxTrain
+		}
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("context length of %s is not advertised", model)
+	}
+
+	c.mu.Lock()
+	c.ctxLen[model] = n
+	c.mu.Unlock()
+	return n, nil
+}
+
+func (c *Client) HealthCheck() (string, error) {
+	if _, err := c.ListModels(context.Background()); err != nil {
+		return "", err
+	}
+	return "ok", nil
+}
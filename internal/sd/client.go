@@ -3,6 +3,7 @@ package sd
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,6 +11,8 @@ import (
 	"time"
 
 	"strings"
+
+	"github.com/calvarado2004/LlamaMux/internal/upstream"
 )
 
 type Client struct {
@@ -55,21 +58,21 @@ func (c *Client) Txt2Img(prompt string, steps int, cfgScale float64, size string
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := c.http.Do(req)
 	if err != nil {
-		return "", err
+		return "", upstream.FromTransport("Stable Diffusion", err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Stable Diffusion error: HTTP %d: %s", resp.StatusCode, string(body))
+		return "", upstream.FromStatus("Stable Diffusion", resp.StatusCode, body)
 	}
 
 	var data map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return "", err
+		return "", upstream.BadResponse("Stable Diffusion", err)
 	}
 	images, ok := data["images"].([]interface{})
 	if !ok || len(images) == 0 {
-		return "", fmt.Errorf("No image returned by Stable Diffusion")
+		return "", upstream.BadResponse("Stable Diffusion", errors.New("no image returned"))
 	}
 	first, _ := images[0].(string)
 	return first, nil
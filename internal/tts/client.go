@@ -0,0 +1,149 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/calvarado2004/LlamaMux/internal/upstream"
+)
+
+// Backend flavours understood by the client
+const (
+	APIPiper  = "piper"  // POST {"text","voice","length_scale"} -> WAV
+	APICoqui  = "coqui"  // GET ?text=&speaker_id= -> WAV
+	APIOpenAI = "openai" // POST {"input","voice","speed","response_format"}
+)
+
+type Client struct {
+	BaseURL string
+	API     string
+	http    *http.Client
+	// ffmpeg binary for formats the backend cannot produce; empty if not on PATH
+	ffmpeg string
+}
+
+type Request struct {
+	Model  string
+	Input  string
+	Voice  string
+	Speed  float64
+	Format string
+}
+
+func NewClient(baseURL, api string) *Client {
+	if api == "" {
+		api = APIPiper
+	}
+	ffmpeg, _ := exec.LookPath("ffmpeg")
+	return &Client{
+		BaseURL: baseURL,
+		API:     api,
+		// no overall timeout: audio is streamed for as long as the backend produces it
+		http:   &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: 120 * time.Second}},
+		ffmpeg: ffmpeg,
+	}
+}
+
+// NativeFormats lists the formats the backend can produce itself.
+// pcm is always available for WAV backends by stripping the header; other
+// formats depend on CanTranscode.
+func (c *Client) NativeFormats() []string {
+	if c.API == APIOpenAI {
+		return []string{"mp3", "opus", "aac", "flac", "wav", "pcm"}
+	}
+	return []string{"wav"}
+}
+
+// Speak starts synthesis and returns the backend's audio body unread so it can be
+// streamed to the caller. The caller must close it.
+func (c *Client) Speak(ctx context.Context, r Request) (io.ReadCloser, error) {
+	var req *http.Request
+	var err error
+
+	switch c.API {
+	case APICoqui:
+		q := url.Values{}
+		q.Set("text", r.Input)
+		if r.Voice != "" {
+			q.Set("speaker_id", r.Voice)
+		}
+		sep := "?"
+		if strings.Contains(c.BaseURL, "?") {
+			sep = "&"
+		}
+		req, err = http.NewRequestWithContext(ctx, "GET", c.BaseURL+sep+q.Encode(), nil)
+
+	case APIOpenAI:
+		payload := map[string]interface{}{
+			"input":           r.Input,
+			"voice":           r.Voice,
+			"speed":           r.Speed,
+			"response_format": r.Format,
+		}
+		if r.Model != "" {
+			payload["model"] = r.Model
+		}
+		b, _ := json.Marshal(payload)
+		req, err = http.NewRequestWithContext(ctx, "POST", c.BaseURL, bytes.NewReader(b))
+
+	default:
+		payload := map[string]interface{}{"text": r.Input}
+		if r.Voice != "" {
+			payload["voice"] = r.Voice
+		}
+		if r.Speed > 0 {
+			// piper's length_scale is the inverse of speed
+			payload["length_scale"] = 1 / r.Speed
+		}
+		b, _ := json.Marshal(payload)
+		req, err = http.NewRequestWithContext(ctx, "POST", c.BaseURL, bytes.NewReader(b))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("TTS error: %v", err)
+	}
+	if req.Method == "POST" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, upstream.FromTransport("TTS", err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, upstream.FromStatus("TTS", resp.StatusCode, body)
+	}
+	return resp.Body, nil
+}
+
+// HealthCheck simple GET on the server root
+func (c *Client) HealthCheck() (string, error) {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("GET", u.Scheme+"://"+u.Host+"/", nil)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 500 {
+		return "ok", nil
+	}
+	return "bad:" + strconv.Itoa(resp.StatusCode), nil
+}
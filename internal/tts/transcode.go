@@ -0,0 +1,82 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// ffmpeg output arguments per response format. opus goes in an Ogg
+// container and aac in ADTS, as OpenAI returns them.
+var ffmpegFormats = map[string][]string{
+	"mp3":  {"-c:a", "libmp3lame", "-f", "mp3"},
+	"opus": {"-c:a", "libopus", "-f", "ogg"},
+	"aac":  {"-c:a", "aac", "-f", "adts"},
+	"flac": {"-c:a", "flac", "-f", "flac"},
+}
+
+// CanTranscode reports whether WAV from the backend can be turned into
+// format, which needs ffmpeg on PATH
+func (c *Client) CanTranscode(format string) bool {
+	_, ok := ffmpegFormats[format]
+	return ok && c.ffmpeg != ""
+}
+
+// Transcode pipes WAV audio from src through ffmpeg into format. The output
+// is streamed as ffmpeg produces it; closing it stops ffmpeg. A failed
+// conversion surfaces as a read error carrying ffmpeg's stderr.
+func (c *Client) Transcode(ctx context.Context, src io.Reader, format string) (io.ReadCloser, error) {
+	args, ok := ffmpegFormats[format]
+	if !ok || c.ffmpeg == "" {
+		return nil, fmt.Errorf("cannot transcode to %s", format)
+	}
+	args = append([]string{"-hide_banner", "-loglevel", "error", "-f", "wav", "-i", "pipe:0"}, args...)
+	cmd := exec.CommandContext(ctx, c.ffmpeg, append(args, "pipe:1")...)
+	cmd.Stdin = src
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %v", err)
+	}
+	return &transcoder{cmd: cmd, out: out, stderr: &stderr}, nil
+}
+
+type transcoder struct {
+	cmd    *exec.Cmd
+	out    io.ReadCloser
+	stderr *bytes.Buffer
+	done   bool
+}
+
+func (t *transcoder) Read(p []byte) (int, error) {
+	n, err := t.out.Read(p)
+	if err == io.EOF && !t.done {
+		t.done = true
+		if werr := t.cmd.Wait(); werr != nil {
+			msg := strings.TrimSpace(t.stderr.String())
+			if msg == "" {
+				msg = werr.Error()
+			}
+			return n, fmt.Errorf("ffmpeg: %s", msg)
+		}
+	}
+	return n, err
+}
+
+func (t *transcoder) Close() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+	t.out.Close()
+	t.cmd.Process.Kill()
+	t.cmd.Wait()
+	return nil
+}
@@ -0,0 +1,56 @@
+package tts
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// WAVInfo is the format of a WAV stream
+type WAVInfo struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+}
+
+// StripWAVHeader reads RIFF chunks up to the "data" chunk and returns the
+// stream positioned at the first PCM sample. Chunk sizes come from the
+// backend, so only the 16 bytes of "fmt " that matter are held in memory and
+// everything else, including the pad byte after an odd-sized chunk, is
+// skipped as it streams past.
+func StripWAVHeader(r io.Reader) (WAVInfo, io.Reader, error) {
+	var info WAVInfo
+	hdr := make([]byte, 12)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return info, nil, err
+	}
+	if string(hdr[0:4]) != "RIFF" || string(hdr[8:12]) != "WAVE" {
+		return info, nil, fmt.Errorf("backend did not return WAV audio")
+	}
+
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return info, nil, err
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		if id == "data" {
+			return info, r, nil
+		}
+		skip := size + size%2
+		if id == "fmt " && size >= 16 {
+			f := make([]byte, 16)
+			if _, err := io.ReadFull(r, f); err != nil {
+				return info, nil, err
+			}
+			info.Channels = int(binary.LittleEndian.Uint16(f[2:4]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(f[4:8]))
+			info.BitsPerSample = int(binary.LittleEndian.Uint16(f[14:16]))
+			skip -= 16
+		}
+		if _, err := io.CopyN(io.Discard, r, skip); err != nil {
+			return info, nil, err
+		}
+	}
+}
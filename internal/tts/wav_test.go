@@ -0,0 +1,69 @@
+package tts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// wav builds a RIFF file from chunks given as id, declared size and body;
+// bodies of odd length are padded as RIFF requires
+func wav(chunks ...interface{}) []byte {
+	var b bytes.Buffer
+	b.WriteString("RIFF\x00\x00\x00\x00WAVE")
+	for i := 0; i < len(chunks); i += 3 {
+		body := chunks[i+2].([]byte)
+		b.WriteString(chunks[i].(string))
+		binary.Write(&b, binary.LittleEndian, chunks[i+1].(uint32))
+		b.Write(body)
+		if len(body)%2 == 1 {
+			b.WriteByte(0)
+		}
+	}
+	return b.Bytes()
+}
+
+func fmtChunk(extra int) []byte {
+	f := make([]byte, 16+extra)
+	binary.LittleEndian.PutUint16(f[0:2], 1)
+	binary.LittleEndian.PutUint16(f[2:4], 1)
+	binary.LittleEndian.PutUint32(f[4:8], 22050)
+	binary.LittleEndian.PutUint16(f[14:16], 16)
+	return f
+}
+
+func TestStripWAVHeader(t *testing.T) {
+	pcm := []byte{1, 2, 3, 4}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"plain", wav("fmt ", uint32(16), fmtChunk(0), "data", uint32(4), pcm)},
+		{"odd fmt", wav("fmt ", uint32(17), fmtChunk(1), "data", uint32(4), pcm)},
+		{"odd LIST", wav("fmt ", uint32(16), fmtChunk(0), "LIST", uint32(3), []byte("abc"), "data", uint32(4), pcm)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, rest, err := StripWAVHeader(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info != (WAVInfo{SampleRate: 22050, Channels: 1, BitsPerSample: 16}) {
+				t.Errorf("info %+v", info)
+			}
+			if got, _ := io.ReadAll(rest); !bytes.Equal(got, pcm) {
+				t.Errorf("PCM %v, want %v", got, pcm)
+			}
+		})
+	}
+}
+
+func TestStripWAVHeaderHugeChunk(t *testing.T) {
+	for _, id := range []string{"fmt ", "LIST"} {
+		data := wav(id, uint32(0xffffffff), fmtChunk(0))
+		if _, _, err := StripWAVHeader(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s chunk larger than the input: no error", id)
+		}
+	}
+}
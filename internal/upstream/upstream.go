@@ -0,0 +1,143 @@
+// Package upstream classifies failures of the services LlamaMux calls
+// (Ollama, OpenAI-compatible servers, Stable Diffusion, OCR, Whisper, TTS)
+// so the API layer can answer with a matching status code.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type Kind int
+
+const (
+	// Failed is an error or unexpected answer from the upstream
+	Failed Kind = iota
+	// Unavailable means unreachable, overloaded or out of memory
+	Unavailable
+	// Timeout means the upstream did not answer in time
+	Timeout
+	// RequestTimeout means the upstream gave up waiting for the request
+	RequestTimeout
+	RateLimited
+	ModelNotFound
+	// ContextOverflow means the prompt does not fit the model's window
+	ContextOverflow
+	// InvalidRequest means the upstream rejected what the client sent
+	InvalidRequest
+)
+
+// Status is the HTTP status LlamaMux answers with for the kind
+func (k Kind) Status() int {
+	switch k {
+	case Unavailable:
+		return http.StatusServiceUnavailable
+	case Timeout:
+		return http.StatusGatewayTimeout
+	case RequestTimeout:
+		return http.StatusRequestTimeout
+	case RateLimited:
+		return http.StatusTooManyRequests
+	case ModelNotFound:
+		return http.StatusNotFound
+	case ContextOverflow, InvalidRequest:
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
+
+type Error struct {
+	Kind    Kind
+	Service string
+	Message string
+	err     error
+}
+
+func (e *Error) Error() string {
+	return e.Service + " error: " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// KindOf returns the kind of an upstream error anywhere in err's chain
+func KindOf(err error) (Kind, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind, true
+	}
+	return Failed, false
+}
+
+// FromStatus classifies an HTTP error response
+func FromStatus(service string, status int, body []byte) *Error {
+	msg := strings.TrimSpace(string(body))
+	return &Error{
+		Kind:    classify(status, msg),
+		Service: service,
+		Message: fmt.Sprintf("HTTP %d: %s", status, msg),
+	}
+}
+
+// FromMessage classifies an error reported inside a response, e.g. a
+// failure in the middle of a stream
+func FromMessage(service, msg string) *Error {
+	return &Error{Kind: classify(http.StatusInternalServerError, msg), Service: service, Message: msg}
+}
+
+// FromTransport classifies a request that got no response. Cancellation by
+// the client is returned unchanged.
+func FromTransport(service string, err error) error {
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	kind := Unavailable
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		kind = Timeout
+	}
+	return &Error{Kind: kind, Service: service, Message: err.Error(), err: err}
+}
+
+// BadResponse wraps an answer that could not be understood
+func BadResponse(service string, err error) *Error {
+	return &Error{Kind: Failed, Service: service, Message: err.Error(), err: err}
+}
+
+func classify(status int, msg string) Kind {
+	lower := strings.ToLower(msg)
+	switch {
+	case status == http.StatusTooManyRequests:
+		return RateLimited
+	case status == http.StatusRequestTimeout:
+		return RequestTimeout
+	case status == http.StatusGatewayTimeout:
+		return Timeout
+	case status == http.StatusServiceUnavailable:
+		return Unavailable
+	case status == http.StatusNotFound && strings.Contains(lower, "model"):
+		return ModelNotFound
+	case overflow(lower):
+		return ContextOverflow
+	case status >= 500 && strings.Contains(lower, "memory"):
+		return Unavailable
+	case status == http.StatusBadRequest || status == http.StatusRequestEntityTooLarge || status == http.StatusUnprocessableEntity:
+		return InvalidRequest
+	}
+	return Failed
+}
+
+// overflow matches the context-length messages of Ollama, vLLM and llama.cpp
+func overflow(msg string) bool {
+	for _, s := range []string{"context length", "context_length", "context window", "maximum context", "exceeds the available context"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}